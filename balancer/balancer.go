@@ -0,0 +1,199 @@
+package balancer
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type Strategy int
+
+const (
+	// RoundRobin sends requests to the endpoints in turn.
+	RoundRobin Strategy = iota
+	// LeastInflight sends requests to the endpoint with the fewest requests
+	// waiting for a response.
+	LeastInflight
+	// Weighted sends requests to the endpoints in proportion to their weight.
+	Weighted
+)
+
+const (
+	DefaultFailureStreak = 3
+	DefaultCooldown      = 10 * time.Second
+)
+
+type Endpoint struct {
+	URL *url.URL
+
+	// Weight is used by the Weighted strategy, it defaults to 1.
+	Weight int
+}
+
+type endpointState struct {
+	Endpoint
+
+	inflight       int
+	currentWeight  int
+	failureStreak  int
+	unhealthyUntil time.Time
+
+	// marked down by the active health checks
+	down bool
+}
+
+// Balancer spreads the requests over the endpoints, skipping the unhealthy
+// ones. An endpoint is marked unhealthy for Cooldown when a request fails to
+// reach it, or after FailureStreak consecutive 5xx responses, and while it's
+// marked unhealthy by SetHealthy. When every endpoint is unhealthy, they are
+// all used.
+type Balancer struct {
+	FailureStreak int
+	Cooldown      time.Duration
+
+	strategy Strategy
+
+	mu        sync.Mutex
+	endpoints []*endpointState
+	next      int
+}
+
+func New(strategy Strategy, endpoints ...Endpoint) *Balancer {
+	b := &Balancer{
+		FailureStreak: DefaultFailureStreak,
+		Cooldown:      DefaultCooldown,
+		strategy:      strategy,
+	}
+
+	for _, e := range endpoints {
+		if e.Weight <= 0 {
+			e.Weight = 1
+		}
+		b.endpoints = append(b.endpoints, &endpointState{Endpoint: e})
+	}
+
+	return b
+}
+
+// NewFromURLs is like New, with endpoints of weight 1.
+func NewFromURLs(strategy Strategy, rawURLs ...string) (*Balancer, error) {
+	endpoints := make([]Endpoint, len(rawURLs))
+	for i, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		endpoints[i] = Endpoint{URL: u}
+	}
+
+	return New(strategy, endpoints...), nil
+}
+
+// Endpoints returns the endpoints, in the order they were given.
+func (b *Balancer) Endpoints() []Endpoint {
+	endpoints := make([]Endpoint, len(b.endpoints))
+	for i, e := range b.endpoints {
+		endpoints[i] = e.Endpoint
+	}
+
+	return endpoints
+}
+
+// SetHealthy marks the endpoints with the URL healthy or not, e.g. after an
+// active health check.
+func (b *Balancer) SetHealthy(u *url.URL, healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range b.endpoints {
+		if e.URL.String() == u.String() {
+			e.down = !healthy
+			if healthy {
+				e.unhealthyUntil = time.Time{}
+				e.failureStreak = 0
+			}
+		}
+	}
+}
+
+// Pick returns the URL of the endpoint the next request is sent to. done must
+// be called with the outcome of the request, its error or response status.
+func (b *Balancer) Pick() (u *url.URL, done func(err error, status int)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+
+	candidates := make([]*endpointState, 0, len(b.endpoints))
+	for _, e := range b.endpoints {
+		if !e.down && !now.Before(e.unhealthyUntil) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.endpoints
+	}
+
+	e := b.pick(candidates)
+	e.inflight++
+
+	return e.URL, func(err error, status int) {
+		b.done(e, err, status)
+	}
+}
+
+func (b *Balancer) pick(candidates []*endpointState) *endpointState {
+	switch b.strategy {
+	case LeastInflight:
+		// ties are broken in turn
+		start := b.next % len(candidates)
+		b.next++
+
+		best := candidates[start]
+		for i := 1; i < len(candidates); i++ {
+			if e := candidates[(start+i)%len(candidates)]; e.inflight < best.inflight {
+				best = e
+			}
+		}
+		return best
+	case Weighted:
+		// smooth weighted round-robin
+		var best *endpointState
+		total := 0
+		for _, e := range candidates {
+			e.currentWeight += e.Weight
+			total += e.Weight
+			if best == nil || e.currentWeight > best.currentWeight {
+				best = e
+			}
+		}
+		best.currentWeight -= total
+		return best
+	default:
+		e := candidates[b.next%len(candidates)]
+		b.next++
+		return e
+	}
+}
+
+func (b *Balancer) done(e *endpointState, err error, status int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.inflight--
+
+	switch {
+	case err != nil:
+		e.failureStreak = 0
+		e.unhealthyUntil = time.Now().Add(b.Cooldown)
+	case status >= http.StatusInternalServerError:
+		e.failureStreak++
+		if e.failureStreak >= b.FailureStreak {
+			e.failureStreak = 0
+			e.unhealthyUntil = time.Now().Add(b.Cooldown)
+		}
+	default:
+		e.failureStreak = 0
+	}
+}
@@ -0,0 +1,163 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("breaker: circuit is open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker opens when the ratio of failed requests reaches
+// FailureRatio, with at least MinRequests requests in the current Interval.
+// Once OpenDuration has passed, a single probe request is allowed: the
+// breaker closes if it succeeds, and opens again otherwise.
+type CircuitBreaker struct {
+	FailureRatio float64
+	MinRequests  int
+	OpenDuration time.Duration
+
+	// Interval is how long requests are counted in the closed state, 0 means
+	// until the state changes.
+	Interval time.Duration
+
+	// OnStateChange is called with the breaker locked, it must not call the
+	// breaker.
+	OnStateChange func(from, to State)
+
+	mu          sync.Mutex
+	state       State
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+func New(failureRatio float64, minRequests int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureRatio: failureRatio,
+		MinRequests:  minRequests,
+		OpenDuration: openDuration,
+		Interval:     time.Minute,
+	}
+}
+
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Allow reports whether a request may be sent, returning ErrOpen otherwise.
+// Every allowed request must be followed by Report, or Release.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.OpenDuration {
+			return ErrOpen
+		}
+
+		b.setState(StateHalfOpen)
+		b.probing = true
+
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+
+		b.probing = true
+
+		return nil
+	default:
+		if b.Interval > 0 && time.Since(b.windowStart) > b.Interval {
+			b.resetCounts()
+		}
+
+		return nil
+	}
+}
+
+// Report records the outcome of an allowed request.
+func (b *CircuitBreaker) Report(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateHalfOpen:
+		b.probing = false
+
+		if success {
+			b.setState(StateClosed)
+		} else {
+			b.setState(StateOpen)
+		}
+	case StateClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+
+		if b.requests >= b.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.FailureRatio {
+			b.setState(StateOpen)
+		}
+	}
+}
+
+// Release ends an allowed request without recording its outcome, e.g. when
+// it was cancelled by the client. A probe request can be allowed again.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *CircuitBreaker) setState(state State) {
+	from := b.state
+
+	b.state = state
+	b.resetCounts()
+	if state == StateOpen {
+		b.openedAt = time.Now()
+	}
+
+	if b.OnStateChange != nil && from != state {
+		b.OnStateChange(from, state)
+	}
+}
+
+func (b *CircuitBreaker) resetCounts() {
+	b.requests = 0
+	b.failures = 0
+	b.windowStart = time.Now()
+}
@@ -0,0 +1,59 @@
+package breaker
+
+import "sync"
+
+// Group holds a circuit breaker per key, e.g. per upstream host, created on
+// first use.
+type Group struct {
+	// New creates the breaker of a key. Its OnStateChange is replaced when
+	// the group's one is set.
+	New func() *CircuitBreaker
+
+	// OnStateChange is called with the key of the breaker changing state. Like
+	// the breaker's one, it's called with the breaker locked.
+	OnStateChange func(key string, from, to State)
+
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+func NewGroup(newBreaker func() *CircuitBreaker) *Group {
+	return &Group{New: newBreaker}
+}
+
+// Get returns the breaker of the key.
+func (g *Group) Get(key string) *CircuitBreaker {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if b, ok := g.breakers[key]; ok {
+		return b
+	}
+
+	b := g.New()
+	if g.OnStateChange != nil {
+		b.OnStateChange = func(from, to State) {
+			g.OnStateChange(key, from, to)
+		}
+	}
+
+	if g.breakers == nil {
+		g.breakers = make(map[string]*CircuitBreaker)
+	}
+	g.breakers[key] = b
+
+	return b
+}
+
+// State returns the state of the key's breaker, closed if it has none yet.
+func (g *Group) State(key string) State {
+	g.mu.Lock()
+	b, ok := g.breakers[key]
+	g.mu.Unlock()
+
+	if !ok {
+		return StateClosed
+	}
+
+	return b.State()
+}
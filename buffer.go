@@ -0,0 +1,133 @@
+package api_client
+
+import (
+	"io"
+	"sync"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// defaultMaxUploadSize bounds the request bodies read in full or decoded when
+// MaxUploadSize isn't set.
+const defaultMaxUploadSize = 32 << 20
+
+var copyBufferPools sync.Map
+
+func copyBuffer(dst io.Writer, src io.Reader, size int) (int64, error) {
+	if size <= 0 {
+		return io.Copy(dst, src)
+	}
+
+	p, _ := copyBufferPools.LoadOrStore(size, &sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		},
+	})
+	pool := p.(*sync.Pool)
+
+	buf := pool.Get().(*[]byte)
+	defer pool.Put(buf)
+
+	// hide io.ReaderFrom and io.WriterTo, so that buf is actually used
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+type maxBytesReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *maxBytesReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, l.tooLarge()
+	}
+
+	// read one byte more than allowed, to tell if the limit is exceeded
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n + int(l.n), l.tooLarge()
+	}
+
+	return n, err
+}
+
+func (l *maxBytesReader) tooLarge() error {
+	if l.err != nil {
+		return l.err
+	}
+
+	return proxy.ErrResponseTooLarge
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type onCloseReadCloser struct {
+	io.ReadCloser
+	once sync.Once
+	fn   func()
+}
+
+func (r *onCloseReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.fn)
+	return err
+}
+
+type onCloseReadWriteCloser struct {
+	*onCloseReadCloser
+	io.Writer
+}
+
+// onClose calls fn once the body is closed. The body of a protocol switching
+// response stays writable.
+func onClose(body io.ReadCloser, fn func()) io.ReadCloser {
+	r := &onCloseReadCloser{ReadCloser: body, fn: fn}
+
+	if w, ok := body.(io.Writer); ok {
+		return &onCloseReadWriteCloser{onCloseReadCloser: r, Writer: w}
+	}
+
+	return r
+}
+
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// flushWriter flushes after every write.
+type flushWriter struct {
+	io.Writer
+	flush func()
+}
+
+func (w *flushWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if err == nil {
+		w.flush()
+	}
+
+	return n, err
+}
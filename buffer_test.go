@@ -0,0 +1,59 @@
+package api_client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func TestCopyBuffer(t *testing.T) {
+	src := bytes.Repeat([]byte("0123456789"), 10000)
+
+	for _, size := range []int{0, 1, 4 << 10} {
+		var dst bytes.Buffer
+		n, err := copyBuffer(&dst, bytes.NewReader(src), size)
+		if err != nil || n != int64(len(src)) || !bytes.Equal(dst.Bytes(), src) {
+			t.Errorf("size %d: copied %d bytes, %v", size, n, err)
+		}
+	}
+}
+
+// discardResponseWriter is a ResponseWriter dropping the body, so that the
+// benchmarks measure the copy rather than the recorder's growth.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func BenchmarkProxyCopyBufferSize(b *testing.B) {
+	body := bytes.Repeat([]byte{'x'}, 8<<20)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, size := range []int{32 << 10, 256 << 10} {
+		b.Run(strconv.Itoa(size>>10)+"KB", func(b *testing.B) {
+			b.SetBytes(int64(len(body)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/video", nil)
+				w := &discardResponseWriter{header: make(http.Header)}
+				if err := c.ProxyAPI("", "", req, w, proxy.RequestBodyTypeNone, proxy.WithCopyBufferSize(size)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
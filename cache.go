@@ -0,0 +1,271 @@
+package api_client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/response"
+)
+
+const defaultCacheMaxObjectSize = 1 << 20
+
+// refreshedHeaders are updated from a 304 revalidating a cached response.
+var refreshedHeaders = []string{"Cache-Control", "Date", "Etag", "Expires"}
+
+// doCached serves the response from the cache when it's fresh, or revalidated
+// with revalidate if it has an ETag. Otherwise, the response of do is cached.
+func (c *Client) doCached(
+	key, method string,
+	opt *proxy.Options,
+	do func() (*response.APIResponse, error),
+	revalidate func(etag string) (*response.APIResponse, error),
+) (*response.APIResponse, error) {
+	now := time.Now()
+
+	cached, ok := opt.Cache.Get(key)
+	if ok && cached.Fresh(now) {
+		return cachedAPIResponse(cached, method), nil
+	}
+
+	var res *response.APIResponse
+	var err error
+	if etag := cachedETag(cached, ok); etag != "" {
+		res, err = revalidate(etag)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode == http.StatusNotModified {
+			res.Body.Close()
+
+			refreshed := *cached
+			refreshed.Header = cached.Header.Clone()
+			for _, h := range refreshedHeaders {
+				if vv := res.Header.Values(h); len(vv) > 0 {
+					refreshed.Header[h] = append([]string(nil), vv...)
+				}
+			}
+			storeCachedResponse(opt, key, &refreshed, now)
+
+			return cachedAPIResponse(&refreshed, method), nil
+		}
+	} else {
+		res, err = do()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !isCacheableStatus(res.StatusCode) || hasCacheControl(res.Header, "no-store") ||
+		hasCacheControl(res.Header, "private") || !varyCovered(res.Header, opt.CacheVary) {
+		return res, nil
+	}
+
+	// HEAD responses keep the encoding and length of the body they don't have
+	var reader io.Reader = res.Body
+	header := res.Header.Clone()
+	if method != http.MethodHead {
+		reader, err = decodeResponseBody(res.Body, res.Header.Get("Content-Encoding"))
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+	}
+
+	maxSize := opt.CacheMaxObjectSize
+	if maxSize <= 0 {
+		maxSize = defaultCacheMaxObjectSize
+	}
+
+	body, ok, err := bufferBody(res, reader, maxSize)
+	if err != nil || !ok {
+		return res, err
+	}
+
+	cached = &proxy.CachedResponse{
+		StatusCode: res.StatusCode,
+		Header:     header,
+		Body:       body,
+	}
+	storeCachedResponse(opt, key, cached, now)
+
+	return cachedAPIResponse(cached, method), nil
+}
+
+// storeCachedResponse stores the response as fresh for the cache TTL, or its
+// freshness lifetime without one. With an ETag, it's kept for another TTL
+// once stale, so that it can be revalidated.
+func storeCachedResponse(opt *proxy.Options, key string, cached *proxy.CachedResponse, now time.Time) {
+	ttl := opt.CacheTTL
+	if ttl <= 0 {
+		if ttl = freshnessLifetime(cached.Header, now); ttl <= 0 {
+			return
+		}
+	}
+
+	cached.Expires = now.Add(ttl)
+	if cached.Header.Get("ETag") != "" {
+		ttl *= 2
+	}
+	opt.Cache.Set(key, cached, ttl)
+}
+
+// freshnessLifetime returns how long the response is fresh for, from its
+// s-maxage or max-age directive, or its Expires header (RFC 7234, section
+// 4.2.1).
+func freshnessLifetime(header http.Header, now time.Time) time.Duration {
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if v, ok := cacheControlValue(header, directive); ok {
+			secs, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || secs < 0 {
+				return 0
+			}
+
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		now = date
+	}
+
+	return expires.Sub(now)
+}
+
+func cachedETag(cached *proxy.CachedResponse, ok bool) string {
+	if !ok {
+		return ""
+	}
+
+	return cached.Header.Get("ETag")
+}
+
+// credentialHeaders are added to the default singleflight and cache keys, so
+// that users don't share responses.
+var credentialHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// credentialKey adds a digest of the credential headers of the request to the
+// key, rather than the credentials themselves, which may be stored remotely.
+func credentialKey(key string, req *http.Request) string {
+	h := sha256.New()
+
+	var found bool
+	for _, name := range credentialHeaders {
+		if vv, ok := req.Header[name]; ok {
+			found = true
+			io.WriteString(h, name+": "+strings.Join(vv, ", ")+"\n")
+		}
+	}
+	if !found {
+		return key
+	}
+
+	return key + "\ncredentials: " + hex.EncodeToString(h.Sum(nil))
+}
+
+// headerKey adds the values of the headers of the request to the key.
+func headerKey(key string, req *http.Request, headers []string) string {
+	for _, h := range headers {
+		key += "\n" + h + ": " + strings.Join(req.Header[h], ", ")
+	}
+
+	return key
+}
+
+// varyCovered reports whether the response only varies on the vary headers,
+// or Accept-Encoding since cached bodies are decompressed.
+func varyCovered(header http.Header, vary []string) bool {
+	for _, h := range headerTokens(header, "Vary") {
+		if h == "*" {
+			return false
+		}
+
+		h = http.CanonicalHeaderKey(h)
+		if h != "Accept-Encoding" && !containsToken(vary, h) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func cachedAPIResponse(cached *proxy.CachedResponse, method string) *response.APIResponse {
+	contentLength := int64(len(cached.Body))
+	if method == http.MethodHead {
+		contentLength = -1
+		if n, err := strconv.ParseInt(cached.Header.Get("Content-Length"), 10, 64); err == nil {
+			contentLength = n
+		}
+	}
+
+	return &response.APIResponse{
+		Response: &http.Response{
+			Status:        http.StatusText(cached.StatusCode),
+			StatusCode:    cached.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        cached.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: contentLength,
+			Request:       &http.Request{Method: method},
+		},
+	}
+}
+
+func isCacheableStatus(status int) bool {
+	switch status {
+	case http.StatusOK,
+		http.StatusNonAuthoritativeInfo,
+		http.StatusNoContent,
+		http.StatusMultipleChoices,
+		http.StatusMovedPermanently,
+		http.StatusNotFound,
+		http.StatusGone:
+		return true
+	default:
+		return false
+	}
+}
+
+// cacheControlValue returns the value of a Cache-Control directive, like
+// max-age=60.
+func cacheControlValue(header http.Header, directive string) (string, bool) {
+	for _, v := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if strings.EqualFold(name, directive) {
+				return strings.Trim(value, `"`), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func hasCacheControl(header http.Header, directive string) bool {
+	for _, v := range header["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(d), directive) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// LRU is an in-memory proxy.CacheStore, holding up to a max number of
+// responses. The least recently used ones are evicted first.
+type LRU struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    *list.List
+	elems      map[string]*list.Element
+}
+
+var _ proxy.CacheStore = (*LRU)(nil)
+
+type lruEntry struct {
+	key     string
+	res     *proxy.CachedResponse
+	expires time.Time
+}
+
+// NewLRU creates the store. maxEntries <= 0 doesn't bound it.
+func NewLRU(maxEntries int) *LRU {
+	return &LRU{
+		maxEntries: maxEntries,
+		entries:    list.New(),
+		elems:      make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) Get(key string) (*proxy.CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.elems[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !time.Now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.entries.MoveToFront(elem)
+
+	return entry.res, true
+}
+
+// Set stores the response for ttl, or until it's evicted if ttl <= 0.
+func (c *LRU) Set(key string, res *proxy.CachedResponse, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if elem, ok := c.elems[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.res = res
+		entry.expires = expires
+		c.entries.MoveToFront(elem)
+		return
+	}
+
+	c.elems[key] = c.entries.PushFront(&lruEntry{key: key, res: res, expires: expires})
+
+	if c.maxEntries > 0 && c.entries.Len() > c.maxEntries {
+		c.remove(c.entries.Back())
+	}
+}
+
+// Len returns the number of stored responses, including expired ones not
+// evicted yet.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.entries.Len()
+}
+
+func (c *LRU) remove(elem *list.Element) {
+	c.entries.Remove(elem)
+	delete(c.elems, elem.Value.(*lruEntry).key)
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+const defaultTimeout = time.Second
+
+// Store is a proxy.CacheStore keeping the responses in Redis, JSON encoded,
+// so that they are shared by the proxy instances. Redis errors are treated
+// as cache misses.
+type Store struct {
+	client  goredis.UniversalClient
+	prefix  string
+	timeout time.Duration
+}
+
+var _ proxy.CacheStore = (*Store)(nil)
+
+// NewStore creates the store, with the keys prefixed by prefix. Redis calls
+// time out after a second, unless another timeout is given.
+func NewStore(client goredis.UniversalClient, prefix string, timeout ...time.Duration) *Store {
+	s := &Store{
+		client:  client,
+		prefix:  prefix,
+		timeout: defaultTimeout,
+	}
+	if len(timeout) > 0 && timeout[0] > 0 {
+		s.timeout = timeout[0]
+	}
+
+	return s
+}
+
+func (s *Store) Get(key string) (*proxy.CachedResponse, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err != nil {
+		return nil, false
+	}
+
+	var res proxy.CachedResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, false
+	}
+
+	return &res, true
+}
+
+// Set stores the response for ttl, or without expiration if ttl <= 0.
+func (s *Store) Set(key string, res *proxy.CachedResponse, ttl time.Duration) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	s.client.Set(ctx, s.prefix+key, data, ttl)
+}
@@ -0,0 +1,371 @@
+package api_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/cache"
+	"github.com/operaads/api-client/proxy"
+)
+
+func proxyGet(t *testing.T, c *Client, target string, header http.Header, opts ...proxy.Option) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, vv := range header {
+		req.Header[k] = vv
+	}
+
+	rec := httptest.NewRecorder()
+	if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, opts...); err != nil {
+		t.Fatalf("ProxyAPI: %v", err)
+	}
+
+	return rec
+}
+
+func TestCacheKeyedByCredentials(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	opt := proxy.WithCache(cache.NewLRU(10), time.Minute)
+
+	alice := http.Header{"Authorization": {"Bearer alice"}}
+	bob := http.Header{"Authorization": {"Bearer bob"}}
+
+	for _, tc := range []struct {
+		header http.Header
+		body   string
+		hits   int32
+	}{
+		{alice, "Bearer alice", 1},
+		{bob, "Bearer bob", 2},
+		{alice, "Bearer alice", 2},
+		{bob, "Bearer bob", 2},
+	} {
+		rec := proxyGet(t, c, "/me", tc.header, opt)
+		if got := rec.Body.String(); got != tc.body {
+			t.Errorf("body = %q, want %q", got, tc.body)
+		}
+		if got := atomic.LoadInt32(&hits); got != tc.hits {
+			t.Errorf("upstream hits = %d, want %d", got, tc.hits)
+		}
+	}
+}
+
+func TestCacheSkipsPrivateResponses(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Cache-Control", "max-age=60, private")
+		w.Write([]byte("secret"))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	store := cache.NewLRU(10)
+
+	for i := 0; i < 2; i++ {
+		proxyGet(t, c, "/private", nil, proxy.WithCache(store, time.Minute))
+	}
+
+	if hits != 2 {
+		t.Errorf("upstream hits = %d, want 2", hits)
+	}
+	if store.Len() != 0 {
+		t.Errorf("cached %d responses, want 0", store.Len())
+	}
+}
+
+func TestSingleflightKeyedByCredentials(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte(r.Header.Get("Cookie")))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	bodies := make(chan string, 2)
+	for _, cookie := range []string{"session=a", "session=b"} {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Cookie", cookie)
+		go func() {
+			rec := httptest.NewRecorder()
+			if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, proxy.WithSingleflight(nil)); err != nil {
+				t.Errorf("ProxyAPI: %v", err)
+			}
+			bodies <- rec.Body.String()
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	got := map[string]bool{<-bodies: true, <-bodies: true}
+	if !got["session=a"] || !got["session=b"] {
+		t.Errorf("bodies = %v, want one per cookie", got)
+	}
+}
+
+func TestCacheRefreshesETagOnRevalidation(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&hits, 1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("ETag", `"v2"`)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if n > 1 {
+			t.Errorf("request %d: If-None-Match = %q", n, r.Header.Get("If-None-Match"))
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("body"))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	store := cache.NewLRU(10)
+	opts := []proxy.Option{
+		proxy.WithCache(store, 50*time.Millisecond),
+		proxy.WithTransferResponseHeaders("ETag"),
+	}
+
+	proxyGet(t, c, "/etag", nil, opts...)
+	time.Sleep(60 * time.Millisecond)
+
+	rec := proxyGet(t, c, "/etag", nil, opts...)
+	if got := rec.Body.String(); got != "body" {
+		t.Errorf("body = %q, want %q", got, "body")
+	}
+	if got := rec.Header().Get("ETag"); got != `"v2"` {
+		t.Errorf("ETag = %q, want %q", got, `"v2"`)
+	}
+}
+
+func TestCacheKeepsHeadContentLength(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Length", "42")
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	opt := proxy.WithCache(cache.NewLRU(10), time.Minute)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodHead, "/head", nil)
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, opt); err != nil {
+			t.Fatalf("ProxyAPI: %v", err)
+		}
+		if got := rec.Header().Get("Content-Length"); got != "42" {
+			t.Errorf("request %d: Content-Length = %q, want 42", i, got)
+		}
+	}
+
+	if hits != 1 {
+		t.Errorf("upstream hits = %d, want 1", hits)
+	}
+}
+
+func TestCacheTTLFallsBackToFreshness(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fresh" {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		path   string
+		cached int
+	}{
+		{"/fresh", 1},
+		{"/unknown", 0},
+	} {
+		store := cache.NewLRU(10)
+		proxyGet(t, c, tc.path, nil, proxy.WithCache(store, 0))
+
+		if store.Len() != tc.cached {
+			t.Errorf("%s: cached %d responses, want %d", tc.path, store.Len(), tc.cached)
+		}
+		key := "GET " + upstream.URL + tc.path
+		if cached, ok := store.Get(key); ok != (tc.cached == 1) {
+			t.Errorf("%s: cached under %q = %v", tc.path, key, ok)
+		} else if ok && cached.Expires.IsZero() {
+			t.Errorf("%s: cached response never expires", tc.path)
+		}
+	}
+}
+
+func TestSingleflightLeaderCancellation(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		select {
+		case <-release:
+			w.Write([]byte("shared"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	opt := proxy.WithSingleflight(nil)
+
+	proxyWith := func(ctx context.Context) (*httptest.ResponseRecorder, error) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/shared", nil).WithContext(ctx)
+		return rec, c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, opt)
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := proxyWith(leaderCtx)
+		leaderErr <- err
+	}()
+	waitFor(t, func() bool { return atomic.LoadInt32(&hits) == 1 })
+
+	type result struct {
+		rec *httptest.ResponseRecorder
+		err error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		rec, err := proxyWith(context.Background())
+		waiter <- result{rec, err}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	cancelLeader()
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader err = %v, want context.Canceled", err)
+	}
+
+	close(release)
+	r := <-waiter
+	if r.err != nil {
+		t.Fatalf("waiter ProxyAPI: %v", r.err)
+	}
+	if got := r.rec.Body.String(); got != "shared" {
+		t.Errorf("waiter body = %q, want %q", got, "shared")
+	}
+	if hits != 1 {
+		t.Errorf("upstream hits = %d, want 1", hits)
+	}
+}
+
+// newTenantUpstreams returns upstreams writing their tenant name once release
+// is closed.
+func newTenantUpstreams(release <-chan struct{}, names ...string) map[string]*httptest.Server {
+	upstreams := make(map[string]*httptest.Server, len(names))
+	for _, name := range names {
+		name := name
+		upstreams[name] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			w.Write([]byte(name))
+		}))
+	}
+
+	return upstreams
+}
+
+// routeToTenant rewrites the upstream URL to the tenant upstream.
+func routeToTenant(upstream *httptest.Server) proxy.Option {
+	return proxy.WithURLInterceptor(func(u *url.URL) {
+		u.Host = upstream.Listener.Addr().String()
+	})
+}
+
+func TestCacheKeyedByUpstream(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+
+	tenants := newTenantUpstreams(release, "a", "b")
+	for _, upstream := range tenants {
+		defer upstream.Close()
+	}
+
+	shared := NewClient(WithBaseURL(tenants["a"].URL))
+	resolver := proxy.WithUpstreamResolver(func(r *http.Request) (*url.URL, error) {
+		return url.Parse(tenants[r.Header.Get("X-Tenant")].URL)
+	})
+
+	for _, tc := range []struct {
+		name  string
+		route func(tenant string) (*Client, []proxy.Option)
+	}{
+		{"resolver", func(tenant string) (*Client, []proxy.Option) {
+			return shared, []proxy.Option{resolver}
+		}},
+		{"url interceptor", func(tenant string) (*Client, []proxy.Option) {
+			return shared, []proxy.Option{routeToTenant(tenants[tenant])}
+		}},
+		{"client base url", func(tenant string) (*Client, []proxy.Option) {
+			return NewClient(WithBaseURL(tenants[tenant].URL)), nil
+		}},
+	} {
+		store := cache.NewLRU(10)
+
+		for _, tenant := range []string{"a", "b", "a", "b"} {
+			c, opts := tc.route(tenant)
+			opts = append(opts, proxy.WithCache(store, time.Minute))
+
+			rec := proxyGet(t, c, "/config", http.Header{"X-Tenant": {tenant}}, opts...)
+			if got := rec.Body.String(); got != tenant {
+				t.Errorf("%s: tenant %s got %q", tc.name, tenant, got)
+			}
+		}
+	}
+}
+
+func TestSingleflightKeyedByUpstream(t *testing.T) {
+	release := make(chan struct{})
+
+	tenants := newTenantUpstreams(release, "a", "b")
+	for _, upstream := range tenants {
+		defer upstream.Close()
+	}
+
+	c := NewClient(WithBaseURL(tenants["a"].URL))
+
+	bodies := make(chan string, 2)
+	for _, tenant := range []string{"a", "b"} {
+		opts := []proxy.Option{routeToTenant(tenants[tenant]), proxy.WithSingleflight(nil)}
+		go func() {
+			rec := httptest.NewRecorder()
+			if err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/config", nil), rec, proxy.RequestBodyTypeNone, opts...); err != nil {
+				t.Errorf("ProxyAPI: %v", err)
+			}
+			bodies <- rec.Body.String()
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	got := map[string]bool{<-bodies: true, <-bodies: true}
+	if !got["a"] || !got["b"] {
+		t.Errorf("bodies = %v, want one per tenant", got)
+	}
+}
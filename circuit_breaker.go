@@ -0,0 +1,41 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/operaads/api-client/breaker"
+)
+
+// breakerTransport fails requests fast while the breaker of their host is
+// open.
+type breakerTransport struct {
+	base     http.RoundTripper
+	breakers *breaker.Group
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.breakers.Get(req.URL.Host)
+	if err := b.Allow(); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	res, err := t.base.RoundTrip(req)
+	reportBreaker(b, req.Context(), res, err)
+
+	return res, err
+}
+
+// reportBreaker reports the outcome of the request to the breaker, unless the
+// request failed because ctx, the one of the client, was done.
+func reportBreaker(b *breaker.CircuitBreaker, ctx context.Context, res *http.Response, err error) {
+	if err != nil && ctx.Err() != nil {
+		b.Release()
+		return
+	}
+
+	b.Report(err == nil && res.StatusCode < http.StatusInternalServerError)
+}
@@ -0,0 +1,61 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/breaker"
+)
+
+func TestBreakerTransportIgnoresClientCancellation(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	group := breaker.NewGroup(func() *breaker.CircuitBreaker {
+		return breaker.New(0.5, 1, 10*time.Millisecond)
+	})
+	transport := &breakerTransport{base: http.DefaultTransport, breakers: group}
+
+	roundTrip := func(path string, timeout time.Duration) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+path, nil)
+		if res, err := transport.RoundTrip(req); err == nil {
+			res.Body.Close()
+		}
+	}
+	b := group.Get(upstream.Listener.Addr().String())
+
+	roundTrip("/slow", 10*time.Millisecond)
+	if got := b.State(); got != breaker.StateClosed {
+		t.Fatalf("state after a cancelled request = %v, want closed", got)
+	}
+
+	roundTrip("/fail", time.Second)
+	if got := b.State(); got != breaker.StateOpen {
+		t.Fatalf("state after a failure = %v, want open", got)
+	}
+
+	// the cancelled probe doesn't keep the breaker half-open
+	time.Sleep(20 * time.Millisecond)
+	roundTrip("/slow", 10*time.Millisecond)
+	if got := b.State(); got != breaker.StateHalfOpen {
+		t.Fatalf("state after a cancelled probe = %v, want half-open", got)
+	}
+	if err := b.Allow(); err != nil {
+		t.Errorf("Allow after a cancelled probe: %v", err)
+	}
+}
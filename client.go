@@ -5,22 +5,90 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sync"
 	"time"
 
+	"github.com/operaads/api-client/balancer"
+	"github.com/operaads/api-client/breaker"
 	"github.com/operaads/api-client/interceptor"
+	"github.com/operaads/api-client/metrics"
 	"github.com/operaads/api-client/request"
 	"github.com/operaads/api-client/response"
+	"github.com/operaads/api-client/retry"
+	"github.com/operaads/api-client/tracing"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/jwt"
+	"golang.org/x/sync/singleflight"
 )
 
 type Client struct {
+	// Client is used for all outgoing requests, including proxied ones.
+	// When nil, http.DefaultClient is used.
 	*http.Client
 
 	APIBaseURL     *url.URL
 	RequestTimeout time.Duration
+	DefaultHeaders http.Header
 
 	URLInterceptor     interceptor.URLInterceptor
 	RequestInterceptor interceptor.RequestInterceptor
+
+	// RetryPolicy, if set, retries failed requests.
+	RetryPolicy *retry.Policy
+
+	// Metrics, if set, records the requests.
+	Metrics metrics.Collector
+
+	// Tracer, if set, traces the requests and propagates the spans upstream.
+	Tracer tracing.Tracer
+
+	// Breakers, if set, fail requests fast while the breaker of their host is
+	// open.
+	Breakers *breaker.Group
+
+	// LoadBalancer, if set, spreads the requests to the base URL host over its
+	// endpoints.
+	LoadBalancer *balancer.Balancer
+
+	// ErrorOnNon2xx makes DoAPIRequest return non-2xx responses as *APIError.
+	ErrorOnNon2xx bool
+
+	rateLimiter *rateLimiter
+	quota       *quotaTracker
+	middlewares []Middleware
+	latencies   latencyWindow
+
+	flight singleflight.Group
+
+	// guards the health checker, started lazily by proxy.WithHealthProbe
+	healthMu sync.Mutex
+	health   *healthChecker
+	closed   bool
+}
+
+func NewClient(opts ...Option) *Client {
+	opt := newOptions(opts...)
+
+	var httpClient *http.Client
+	if opt.HTTPClient != nil {
+		httpClient = opt.HTTPClient
+	} else {
+		httpClient = &http.Client{Transport: opt.transport()}
+	}
+
+	if opt.OAuth2 != nil {
+		cl := *httpClient
+
+		transport := cl.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		cl.Transport = &oauth2Transport{base: transport, config: opt.OAuth2}
+
+		httpClient = &cl
+	}
+
+	return newClient(httpClient, opt)
 }
 
 func NewJWTClient(jwtConfig *jwt.Config, baseURL string, opts ...Option) *Client {
@@ -28,11 +96,19 @@ func NewJWTClient(jwtConfig *jwt.Config, baseURL string, opts ...Option) *Client
 		panic("jwtConfig is nil")
 	}
 
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		panic(err)
+	opt := newOptions(append([]Option{WithBaseURL(baseURL)}, opts...)...)
+
+	ctx := context.Background()
+	if opt.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, opt.HTTPClient)
+	} else if transport := opt.transport(); transport != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
 	}
 
+	return newClient(jwtConfig.Client(ctx), opt)
+}
+
+func newOptions(opts ...Option) *Options {
 	opt := &Options{
 		RequestTimeout: 10 * time.Second,
 	}
@@ -41,23 +117,136 @@ func NewJWTClient(jwtConfig *jwt.Config, baseURL string, opts ...Option) *Client
 		o(opt)
 	}
 
-	return &Client{
-		Client:             jwtConfig.Client(context.Background()),
+	return opt
+}
+
+func newClient(httpClient *http.Client, opt *Options) *Client {
+	var u *url.URL
+	if opt.BaseURL != "" {
+		var err error
+		if u, err = url.Parse(opt.BaseURL); err != nil {
+			panic(err)
+		}
+	} else if opt.LoadBalancer != nil {
+		if endpoints := opt.LoadBalancer.Endpoints(); len(endpoints) > 0 {
+			u = endpoints[0].URL
+		}
+	}
+
+	c := &Client{
+		Client:             httpClient,
 		APIBaseURL:         u,
 		RequestTimeout:     opt.RequestTimeout,
+		DefaultHeaders:     opt.DefaultHeaders,
 		URLInterceptor:     opt.URLInterceptor,
 		RequestInterceptor: opt.RequestInterceptor,
+		RetryPolicy:        opt.RetryPolicy,
+		Breakers:           opt.Breakers,
+		Metrics:            opt.Metrics,
+		Tracer:             opt.Tracer,
+		LoadBalancer:       opt.LoadBalancer,
+		ErrorOnNon2xx:      opt.ErrorOnNon2xx,
+		rateLimiter:        newRateLimiter(opt.RateLimits, opt.RateLimitFailFast),
+		quota:              newQuotaTracker(opt.QuotaHeaders, opt.RateLimitFailFast),
+		health:             newHealthChecker(opt.HealthCheckPath, opt.HealthCheckInterval),
+		middlewares:        opt.Middlewares,
+	}
+
+	if c.health != nil {
+		go c.runHealthChecks(c.health)
+	}
+
+	return c
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.Client != nil {
+		return c.Client
 	}
+
+	return http.DefaultClient
+}
+
+// RoundTripper returns the transport outgoing requests are sent with, e.g. to
+// be wrapped by middlewares and passed to proxy.WithRoundTripper.
+func (c *Client) RoundTripper() http.RoundTripper {
+	if transport := c.httpClient().Transport; transport != nil {
+		return transport
+	}
+
+	return http.DefaultTransport
 }
 
 func (c *Client) DoAPIRequest(req *request.APIRequest) (*response.APIResponse, error) {
+	d := c.doer()
+	if c.ErrorOnNon2xx {
+		d = errorOnNon2xx(d)
+	}
+
+	return d.Do(req)
+}
+
+// sendAPIRequest sends the request, inside the middlewares.
+func (c *Client) sendAPIRequest(req *request.APIRequest) (*response.APIResponse, error) {
+	fullURL, err := c.apiRequestURL(req)
+	if err != nil {
+		return nil, err
+	}
+
+	requestTimeout := c.RequestTimeout
+	if req.RequestTimeout != 0 {
+		requestTimeout = req.RequestTimeout
+	}
+
+	ctx := req.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// the deadline must outlive this call, until the response body is closed
+	cancel := context.CancelFunc(func() {})
+	if requestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+	}
+
+	var span tracing.Span
+	if c.Tracer != nil {
+		ctx, span = startRequestSpan(ctx, c.Tracer, req.Method, fullURL)
+	}
+
+	var res *http.Response
+	if c.Metrics != nil {
+		res, err = c.doAPIRequestWithMetrics(ctx, fullURL, req)
+	} else {
+		res, err = c.doAPIRequest(ctx, fullURL, req)
+	}
+	if err != nil {
+		cancel()
+		if span != nil {
+			span.RecordError(err)
+			span.End()
+		}
+		return nil, err
+	}
+
+	if span != nil {
+		res.Body = traceResponseBody(res, span)
+	}
+	res.Body = onClose(res.Body, cancel)
+
+	return &response.APIResponse{Response: res}, nil
+}
+
+// apiRequestURL resolves the request URL against the base URL, and runs the
+// URL interceptors.
+func (c *Client) apiRequestURL(req *request.APIRequest) (*url.URL, error) {
 	u, err := url.Parse(req.URL)
 	if err != nil {
 		return nil, err
 	}
 
 	var fullURL *url.URL
-	if u.Scheme != "" {
+	if u.Scheme != "" || c.APIBaseURL == nil {
 		fullURL = u
 	} else {
 		fullURL = &url.URL{
@@ -76,15 +265,89 @@ func (c *Client) DoAPIRequest(req *request.APIRequest) (*response.APIResponse, e
 		intcp(fullURL)
 	}
 
-	requestTimeout := c.RequestTimeout
-	if req.RequestTimeout > 0 {
-		requestTimeout = req.RequestTimeout
+	return fullURL, nil
+}
+
+func (c *Client) doAPIRequestWithMetrics(ctx context.Context, fullURL *url.URL, req *request.APIRequest) (*http.Response, error) {
+	path := req.PathTemplate
+	if path == "" {
+		path = fullURL.Path
+	}
+
+	c.Metrics.RequestStarted(req.Method, path)
+	start := time.Now()
+
+	res, err := c.doAPIRequest(ctx, fullURL, req)
+
+	var status int
+	if err == nil {
+		status = res.StatusCode
 	}
+	c.Metrics.RequestDone(req.Method, path, status, time.Since(start))
 
-	timeoutCtx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
+	return res, err
+}
 
-	httpReq, err := http.NewRequestWithContext(timeoutCtx, req.Method, fullURL.String(), req.Body)
+func (c *Client) doAPIRequest(ctx context.Context, fullURL *url.URL, req *request.APIRequest) (*http.Response, error) {
+	httpReq, err := c.newHTTPRequest(ctx, fullURL, req)
+	if err != nil {
+		return nil, err
+	}
+
+	retryPolicy := c.RetryPolicy
+	if req.RetryPolicy != nil {
+		retryPolicy = req.RetryPolicy
+	}
+
+	wrapTransport := len(req.Transports) > 0 || retryPolicy != nil || c.Breakers != nil ||
+		c.rateLimiter != nil || c.quota != nil || c.LoadBalancer != nil || req.HedgePolicy != nil
+
+	httpClient := c.httpClient()
+	if req.CheckRedirect != nil || wrapTransport {
+		cl := *httpClient
+		if req.CheckRedirect != nil {
+			cl.CheckRedirect = req.CheckRedirect
+		}
+
+		if wrapTransport {
+			transport := cl.Transport
+			if transport == nil {
+				transport = http.DefaultTransport
+			}
+			for _, wrap := range req.Transports {
+				transport = wrap(transport)
+			}
+			if c.quota != nil {
+				transport = &quotaTransport{base: transport, tracker: c.quota}
+			}
+			if c.rateLimiter != nil {
+				transport = &rateLimitTransport{base: transport, limiter: c.rateLimiter}
+			}
+			if c.Breakers != nil {
+				transport = &breakerTransport{base: transport, breakers: c.Breakers}
+			}
+			if c.LoadBalancer != nil && c.APIBaseURL != nil {
+				transport = &balancerTransport{base: transport, balancer: c.LoadBalancer, host: c.APIBaseURL.Host}
+			}
+			if req.HedgePolicy != nil {
+				transport = &hedgeTransport{base: transport, policy: req.HedgePolicy, latencies: &c.latencies}
+			}
+			if retryPolicy != nil {
+				transport = &retryTransport{base: transport, policy: retryPolicy}
+			}
+			cl.Transport = transport
+		}
+
+		httpClient = &cl
+	}
+
+	return httpClient.Do(httpReq)
+}
+
+// newHTTPRequest builds the request, with the request interceptors, default
+// headers, body compression and send hooks applied.
+func (c *Client) newHTTPRequest(ctx context.Context, fullURL *url.URL, req *request.APIRequest) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, fullURL.String(), req.Body)
 	if err != nil {
 		return nil, err
 	}
@@ -96,10 +359,33 @@ func (c *Client) DoAPIRequest(req *request.APIRequest) (*response.APIResponse, e
 		intcp(httpReq)
 	}
 
-	res, err := c.Do(httpReq)
-	if err != nil {
-		return nil, err
+	for k, vv := range c.DefaultHeaders {
+		if _, ok := httpReq.Header[k]; !ok {
+			httpReq.Header[k] = append([]string(nil), vv...)
+		}
 	}
 
-	return &response.APIResponse{Response: res}, nil
+	if req.BodyEncoding != "" {
+		if err := compressRequestBody(httpReq, req.BodyEncoding); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Tracer != nil {
+		c.Tracer.Inject(ctx, httpReq.Header)
+	}
+
+	for _, hook := range req.SendHooks {
+		if err := hook(httpReq); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Signer != nil {
+		if err := req.Signer(httpReq); err != nil {
+			return nil, err
+		}
+	}
+
+	return httpReq, nil
 }
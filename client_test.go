@@ -0,0 +1,106 @@
+package api_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/request"
+)
+
+// recordingTransport records the paths of the requests it sends.
+type recordingTransport struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.paths = append(t.paths, req.URL.Path)
+	t.mu.Unlock()
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestInjectedHTTPClient(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	for _, tc := range []struct {
+		name string
+		opt  func(*recordingTransport) Option
+	}{
+		{"http client", func(rt *recordingTransport) Option {
+			return WithHTTPClient(&http.Client{Transport: rt})
+		}},
+		{"transport", func(rt *recordingTransport) Option {
+			return WithTransport(rt)
+		}},
+	} {
+		rt := &recordingTransport{}
+		c := NewClient(WithBaseURL(upstream.URL), tc.opt(rt))
+
+		res, err := c.DoAPIRequest(request.NewAPIRequest(http.MethodGet, "/direct", nil))
+		if err != nil {
+			t.Fatalf("%s: DoAPIRequest: %v", tc.name, err)
+		}
+		res.Body.Close()
+
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/proxied", nil), rec, proxy.RequestBodyTypeNone); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+
+		if len(rt.paths) != 2 || rt.paths[0] != "/direct" || rt.paths[1] != "/proxied" {
+			t.Errorf("%s: sent %v, want [/direct /proxied]", tc.name, rt.paths)
+		}
+	}
+}
+
+// headerTransport sets a header on the requests it sends with base.
+type headerTransport struct {
+	base  http.RoundTripper
+	calls int32
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.calls, 1)
+
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Middleware", "1")
+
+	return t.base.RoundTrip(req)
+}
+
+func TestProxyRoundTripper(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Middleware")))
+	}))
+	defer upstream.Close()
+
+	rt := &recordingTransport{}
+	c := NewClient(WithBaseURL(upstream.URL), WithTransport(rt))
+	if got := c.RoundTripper(); got != rt {
+		t.Fatalf("RoundTripper() = %T, want the client transport", got)
+	}
+
+	middleware := &headerTransport{base: c.RoundTripper()}
+	rec := proxyGet(t, c, "/wrapped", nil, proxy.WithRoundTripper(middleware))
+
+	if middleware.calls != 1 {
+		t.Errorf("middleware called %d times, want 1", middleware.calls)
+	}
+	if got := rec.Body.String(); got != "1" {
+		t.Errorf("upstream got X-Middleware %q, want 1", got)
+	}
+	if len(rt.paths) != 1 || rt.paths[0] != "/wrapped" {
+		t.Errorf("client transport sent %v, want [/wrapped]", rt.paths)
+	}
+
+	if got := NewClient().RoundTripper(); got != http.DefaultTransport {
+		t.Errorf("default RoundTripper() = %T, want http.DefaultTransport", got)
+	}
+}
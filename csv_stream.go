@@ -0,0 +1,51 @@
+package api_client
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/operaads/api-client/interceptor"
+	"github.com/operaads/api-client/proxy"
+)
+
+func streamCSV(r io.Reader, w io.Writer, intcp interceptor.CSVInterceptor) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	writer := csv.NewWriter(w)
+
+	var header []string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		var newRow []string
+		if header == nil {
+			header = append([]string(nil), row...)
+			newRow, err = intcp(nil, header)
+		} else {
+			newRow, err = intcp(header, row)
+		}
+
+		if err == proxy.ErrSkipRow {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if newRow == nil {
+			continue
+		}
+
+		if err := writer.Write(newRow); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
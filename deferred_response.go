@@ -0,0 +1,86 @@
+package api_client
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/response"
+)
+
+// deferredResponseWriter buffers the response, so that nothing is written
+// until it's complete.
+type deferredResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *deferredResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *deferredResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *deferredResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(p)
+}
+
+// commit writes the buffered response. Trailers are sent as headers, since
+// they're known by now.
+func (w *deferredResponseWriter) commit(resWriter http.ResponseWriter) error {
+	for k, vv := range w.header {
+		if k != "Trailer" {
+			resWriter.Header()[k] = vv
+		}
+	}
+
+	resWriter.WriteHeader(w.status)
+	_, err := w.body.WriteTo(resWriter)
+
+	return err
+}
+
+// writeDeferredProxyResponse is writeProxyResponse, with the response written
+// only once the interceptors succeeded. Otherwise, the error status is
+// written instead.
+func writeDeferredProxyResponse(
+	httpReq *http.Request,
+	res *response.APIResponse,
+	resWriter http.ResponseWriter,
+	opt *proxy.Options,
+	result *proxy.Result,
+) error {
+	deferred := &deferredResponseWriter{header: make(http.Header)}
+
+	if err := writeProxyResponse(httpReq, res, deferred, opt, result); err != nil {
+		if opt.ErrorHandler != nil {
+			result.StatusCode = 0
+			result.BytesWritten = 0
+			opt.ErrorHandler(resWriter, httpReq, err)
+
+			return err
+		}
+
+		status := opt.DeferredErrorStatus
+		if status == 0 {
+			status = http.StatusBadGateway
+		}
+
+		result.StatusCode = status
+		result.BytesWritten = 0
+		http.Error(resWriter, http.StatusText(status), status)
+
+		return err
+	}
+
+	return deferred.commit(resWriter)
+}
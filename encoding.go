@@ -0,0 +1,194 @@
+package api_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+const defaultCompressMinSize = 1 << 10
+
+// acceptsEncoding reports whether the request's Accept-Encoding allows the
+// content coding.
+func acceptsEncoding(req *http.Request, coding string) bool {
+	wildcard := false
+
+	for _, v := range req.Header["Accept-Encoding"] {
+		for _, part := range strings.Split(v, ",") {
+			name, q := parseQValue(part)
+			if strings.EqualFold(name, coding) {
+				return q > 0
+			}
+			if name == "*" {
+				wildcard = q > 0
+			}
+		}
+	}
+
+	return wildcard
+}
+
+func parseQValue(s string) (string, float64) {
+	parts := strings.Split(s, ";")
+	name := strings.TrimSpace(parts[0])
+
+	q := 1.0
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "q=") {
+			if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+
+	return name, q
+}
+
+// decompressRequestBody replaces the request body with its decoded content,
+// and reports whether the body was decoded.
+func decompressRequestBody(req *http.Request, opt *proxy.Options) (bool, error) {
+	if !hasBody(req) {
+		return false, nil
+	}
+
+	var reader io.Reader
+
+	switch strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		gzReader, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return false, err
+		}
+		reader = gzReader
+	case "deflate":
+		zReader, err := zlib.NewReader(req.Body)
+		if err != nil {
+			return false, err
+		}
+		reader = zReader
+	default:
+		return false, nil
+	}
+
+	// guards against decompression bombs
+	maxSize := opt.MaxUploadSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxUploadSize
+	}
+	reader = &maxBytesReader{r: reader, n: maxSize, err: proxy.ErrRequestTooLarge}
+
+	req.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, req.Body}
+
+	return true, nil
+}
+
+// encodingWriter compresses what's written with a content coding.
+type encodingWriter interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// encodableCodings are the content codings responses can be compressed with,
+// in order of preference.
+var encodableCodings = []string{"br", "zstd", "gzip"}
+
+func newEncodingWriter(w io.Writer, coding string) encodingWriter {
+	switch coding {
+	case "br":
+		return brotli.NewWriter(w)
+	case "zstd":
+		// never fails without options that can be invalid
+		enc, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		return enc
+	default:
+		return gzip.NewWriter(w)
+	}
+}
+
+// responseEncoding returns the content coding the proxy compresses the
+// response body with, or "" if it's written as is.
+func responseEncoding(req *http.Request, upstreamEncoding string, resHeaders http.Header, opt *proxy.Options) string {
+	if resHeaders.Get("Content-Encoding") != "" || isCompressedMediaType(mediaType(resHeaders.Get("Content-Type"))) {
+		return ""
+	}
+
+	// the upstream compressed the body, but it was decoded
+	if opt.RecompressResponse && upstreamEncoding != "" {
+		upstreamEncoding = strings.ToLower(strings.TrimSpace(upstreamEncoding))
+		if containsToken(encodableCodings, upstreamEncoding) && acceptsEncoding(req, upstreamEncoding) {
+			return upstreamEncoding
+		}
+
+		for _, coding := range encodableCodings {
+			if acceptsEncoding(req, coding) {
+				return coding
+			}
+		}
+	}
+
+	if opt.CompressResponse && acceptsEncoding(req, "gzip") {
+		return "gzip"
+	}
+
+	return ""
+}
+
+// compressRequestBody compresses the request body with the content coding,
+// unless it's already encoded. A replayable body is compressed in memory, so
+// that it stays replayable, others are compressed while they're sent.
+func compressRequestBody(req *http.Request, coding string) error {
+	if !hasBody(req) || req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body := req.Body
+
+	if req.GetBody != nil {
+		buf := new(bytes.Buffer)
+		err := compressTo(buf, body, coding)
+		body.Close()
+		if err != nil {
+			return err
+		}
+
+		setRequestBody(req, buf)
+	} else {
+		pr, pw := io.Pipe()
+		go func() {
+			err := compressTo(pw, body, coding)
+			body.Close()
+			pw.CloseWithError(err)
+		}()
+
+		setRequestBody(req, pr)
+	}
+
+	req.Header.Set("Content-Encoding", coding)
+
+	return nil
+}
+
+func compressTo(w io.Writer, r io.Reader, coding string) error {
+	enc := newEncodingWriter(w, coding)
+
+	_, err := io.Copy(enc, r)
+	if closeErr := enc.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,43 @@
+package api_client
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func TestDecompressRequestBodyLimit(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		size    int
+		maxSize int64
+		err     error
+	}{
+		{"under the upload size", 1 << 10, 1 << 10, nil},
+		{"over the upload size", 1<<10 + 1, 1 << 10, proxy.ErrRequestTooLarge},
+		{"under the default", defaultMaxUploadSize, 0, nil},
+		{"over the default", defaultMaxUploadSize + 1, 0, proxy.ErrRequestTooLarge},
+	} {
+		body := gzipBytes(t, make([]byte, tc.size))
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+
+		ok, err := decompressRequestBody(req, &proxy.Options{MaxUploadSize: tc.maxSize})
+		if !ok || err != nil {
+			t.Fatalf("%s: decompressRequestBody = %v, %v", tc.name, ok, err)
+		}
+
+		data, err := ioutil.ReadAll(req.Body)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: read err = %v, want %v", tc.name, err, tc.err)
+		}
+		if tc.err == nil && len(data) != tc.size {
+			t.Errorf("%s: read %d bytes, want %d", tc.name, len(data), tc.size)
+		}
+	}
+}
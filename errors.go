@@ -0,0 +1,73 @@
+package api_client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/operaads/api-client/retry"
+)
+
+// maxAPIErrorBodySize bounds the body kept by APIError.
+const maxAPIErrorBodySize = 64 << 10
+
+// APIError is a non-2xx upstream response. Body is a copy of at most the first
+// 64KiB of the response body, decompressed if it was gzip encoded.
+type APIError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	if len(e.Body) > 0 {
+		return fmt.Sprintf("api error: status %d: %s", e.StatusCode, e.Body)
+	}
+
+	return fmt.Sprintf("api error: status %d", e.StatusCode)
+}
+
+// IsRetryable reports whether the request may succeed if sent again, like
+// after a 429 or a 503.
+func (e *APIError) IsRetryable() bool {
+	return (&retry.Policy{}).Retryable(e.StatusCode)
+}
+
+func isSuccessStatus(status int) bool {
+	return status >= 200 && status <= 299
+}
+
+// checkResponseStatus returns a non-2xx response as *APIError, and closes its
+// body.
+func checkResponseStatus(res *http.Response) error {
+	if isSuccessStatus(res.StatusCode) {
+		return nil
+	}
+
+	defer res.Body.Close()
+
+	// buffered, so that a body that can't be decoded is kept as is
+	raw, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxAPIErrorBodySize))
+
+	var body io.Reader = bytes.NewReader(raw)
+	if reader, err := decodeResponseBody(bytes.NewReader(raw), res.Header.Get("Content-Encoding")); err == nil {
+		// the raw body may be truncated
+		if decoded, err := ioutil.ReadAll(reader); err == nil || len(decoded) > 0 {
+			body = bytes.NewReader(decoded)
+		}
+	}
+
+	return newAPIError(res, body)
+}
+
+func newAPIError(res *http.Response, body io.Reader) *APIError {
+	b, _ := ioutil.ReadAll(io.LimitReader(body, maxAPIErrorBodySize))
+
+	return &APIError{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       b,
+	}
+}
@@ -0,0 +1,94 @@
+package api_client
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+var forwardedHeaderNames = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+}
+
+// setForwardedHeaders sets the forwarding headers of the upstream request.
+// The incoming ones are kept only if the peer is a trusted proxy.
+func setForwardedHeaders(dst http.Header, httpReq *http.Request, opt *proxy.Options) {
+	peer, _, err := net.SplitHostPort(httpReq.RemoteAddr)
+	if err != nil {
+		peer = httpReq.RemoteAddr
+	}
+
+	if !isTrustedProxy(peer, opt.TrustedProxies) {
+		for _, h := range forwardedHeaderNames {
+			dst.Del(h)
+		}
+	}
+
+	proto := "http"
+	if httpReq.TLS != nil {
+		proto = "https"
+	}
+
+	if peer != "" {
+		if prior := dst.Get("X-Forwarded-For"); prior != "" {
+			dst.Set("X-Forwarded-For", prior+", "+peer)
+		} else {
+			dst.Set("X-Forwarded-For", peer)
+		}
+	}
+	if dst.Get("X-Forwarded-Host") == "" {
+		dst.Set("X-Forwarded-Host", httpReq.Host)
+	}
+	if dst.Get("X-Forwarded-Proto") == "" {
+		dst.Set("X-Forwarded-Proto", proto)
+	}
+
+	if opt.ForwardedRFC7239 {
+		elem := "for=" + forwardedNode(peer) + ";host=" + quoteForwarded(httpReq.Host) + ";proto=" + proto
+		if prior := strings.Join(dst["Forwarded"], ", "); prior != "" {
+			elem = prior + ", " + elem
+		}
+		dst.Set("Forwarded", elem)
+	}
+}
+
+func isTrustedProxy(peer string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(peer)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedNode formats the node of a Forwarded header element, IPv6
+// addresses are bracketed and quoted (RFC 7239, section 6).
+func forwardedNode(ip string) string {
+	if ip == "" {
+		return "unknown"
+	}
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+
+	return ip
+}
+
+func quoteForwarded(v string) string {
+	if strings.ContainsAny(v, ":[]") {
+		return `"` + v + `"`
+	}
+
+	return v
+}
@@ -0,0 +1,81 @@
+package api_client
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join([]string{
+			r.Header.Get("X-Forwarded-For"),
+			r.Header.Get("X-Forwarded-Host"),
+			r.Header.Get("X-Forwarded-Proto"),
+			r.Header.Get("Forwarded"),
+		}, "|")))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	_, trusted, _ := net.ParseCIDR("192.0.2.0/24")
+
+	spoofed := http.Header{
+		"X-Forwarded-For":   {"203.0.113.9"},
+		"X-Forwarded-Host":  {"spoofed.example"},
+		"X-Forwarded-Proto": {"https"},
+		"Forwarded":         {"for=203.0.113.9"},
+	}
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		opts       []proxy.Option
+		want       string
+	}{
+		{
+			"no prior", "192.0.2.1:1234", nil,
+			[]proxy.Option{proxy.WithForwardedHeaders(false)},
+			"192.0.2.1|example.com|http|",
+		},
+		{
+			"spoofed", "192.0.2.1:1234", spoofed,
+			[]proxy.Option{proxy.WithForwardedHeaders(true)},
+			"192.0.2.1|example.com|http|for=192.0.2.1;host=example.com;proto=http",
+		},
+		{
+			"trusted proxy", "192.0.2.1:1234", spoofed,
+			[]proxy.Option{proxy.WithForwardedHeaders(true), proxy.WithTrustedProxies(trusted)},
+			"203.0.113.9, 192.0.2.1|spoofed.example|https|for=203.0.113.9, for=192.0.2.1;host=example.com;proto=http",
+		},
+		{
+			"untrusted proxy", "198.51.100.7:1234", spoofed,
+			[]proxy.Option{proxy.WithForwardedHeaders(false), proxy.WithTrustedProxies(trusted)},
+			"198.51.100.7|example.com|http|",
+		},
+		{
+			"ipv6", "[2001:db8::1]:1234", nil,
+			[]proxy.Option{proxy.WithForwardedHeaders(true)},
+			`2001:db8::1|example.com|http|for="[2001:db8::1]";host=example.com;proto=http`,
+		},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/x", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for k, vv := range tc.header {
+			req.Header[k] = vv
+		}
+
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, tc.opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: upstream got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
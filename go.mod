@@ -1,10 +1,19 @@
 module github.com/operaads/api-client
 
-go 1.13
+go 1.18
 
 require (
-	github.com/golang/protobuf v1.4.3 // indirect
-	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b // indirect
+	github.com/andybalholm/brotli v1.0.1
+	github.com/klauspost/compress v1.11.3
 	golang.org/x/oauth2 v0.0.0-20201109201403-9fd604954f58
+	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
+	golang.org/x/time v0.0.0-20201208040808-7e3f01d25324
+)
+
+require (
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/google/go-cmp v0.5.3 // indirect
+	golang.org/x/net v0.0.0-20210428140749-89ef3d95e781 // indirect
 	google.golang.org/appengine v1.6.7 // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
 )
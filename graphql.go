@@ -0,0 +1,103 @@
+package api_client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// ProxyGraphQLAPI proxies a GraphQL request to the upstream path picked by the
+// router. Requests that aren't valid GraphQL requests get a 400, and request
+// bodies larger than MaxUploadSize (32MiB if unset) a 413. Router errors get
+// the response of the error handler, or a plain one with the status of
+// proxy.ErrorStatus, e.g. a 404 for errors wrapping proxy.ErrPathNotFound.
+func (c *Client) ProxyGraphQLAPI(
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	router func(op proxy.GraphQLRequest) (string, error),
+	opts ...proxy.Option,
+) error {
+	opt := c.newProxyOptions(opts...)
+
+	op, body, err := parseGraphQLRequest(httpReq, opt)
+	if err != nil {
+		writeProxyError(resWriter, httpReq, err, opt)
+		return err
+	}
+
+	path, err := router(*op)
+	if err != nil {
+		if opt.ErrorHandler != nil {
+			opt.ErrorHandler(resWriter, httpReq, err)
+		} else {
+			status := proxy.ErrorStatus(err)
+			http.Error(resWriter, http.StatusText(status), status)
+		}
+		return err
+	}
+
+	if httpReq.Method == http.MethodGet {
+		u := &url.URL{Path: path, RawQuery: httpReq.URL.RawQuery}
+		return c.ProxyAPI("", u.String(), httpReq, resWriter, proxy.RequestBodyTypeNone, opts...)
+	}
+
+	httpReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return c.ProxyAPI("", path, httpReq, resWriter, proxy.RequestBodyTypeRaw, opts...)
+}
+
+func parseGraphQLRequest(httpReq *http.Request, opt *proxy.Options) (*proxy.GraphQLRequest, []byte, error) {
+	op := new(proxy.GraphQLRequest)
+
+	if httpReq.Method == http.MethodGet {
+		q := httpReq.URL.Query()
+
+		op.Query = q.Get("query")
+		op.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &op.Variables); err != nil {
+				return nil, nil, proxy.ErrInvalidGraphQLRequest
+			}
+		}
+		if v := q.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &op.Extensions); err != nil {
+				return nil, nil, proxy.ErrInvalidGraphQLRequest
+			}
+		}
+	} else {
+		if !hasBody(httpReq) {
+			return nil, nil, proxy.ErrInvalidGraphQLRequest
+		}
+
+		maxSize := opt.MaxUploadSize
+		if maxSize <= 0 {
+			maxSize = defaultMaxUploadSize
+		}
+
+		body, err := ioutil.ReadAll(&maxBytesReader{r: httpReq.Body, n: maxSize, err: proxy.ErrRequestTooLarge})
+		httpReq.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if err := json.Unmarshal(body, op); err != nil {
+			return nil, nil, proxy.ErrInvalidGraphQLRequest
+		}
+
+		if op.Query == "" && !op.IsPersistedQuery() {
+			return nil, nil, proxy.ErrInvalidGraphQLRequest
+		}
+
+		return op, body, nil
+	}
+
+	if op.Query == "" && !op.IsPersistedQuery() {
+		return nil, nil, proxy.ErrInvalidGraphQLRequest
+	}
+
+	return op, nil, nil
+}
@@ -0,0 +1,61 @@
+package api_client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func TestProxyGraphQLAPI(t *testing.T) {
+	upstream := newEchoUpstream()
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	router := func(op proxy.GraphQLRequest) (string, error) {
+		if op.OperationName == "" {
+			return "", fmt.Errorf("no backend: %w", proxy.ErrPathNotFound)
+		}
+		return "/" + op.OperationName, nil
+	}
+
+	for _, tc := range []struct {
+		name   string
+		body   string
+		opts   []proxy.Option
+		status int
+		want   string
+	}{
+		{"routed", `{"query":"{ me }","operationName":"users"}`, nil, http.StatusOK, "/users "},
+		{"invalid", `{`, nil, http.StatusBadRequest, "Bad Request\n"},
+		{"not routed", `{"query":"{ me }"}`, nil, http.StatusNotFound, "Not Found\n"},
+		{
+			"too large",
+			`{"query":"{ me }","operationName":"users"}`,
+			[]proxy.Option{proxy.WithMaxUploadSize(8)},
+			http.StatusRequestEntityTooLarge, "Request Entity Too Large\n",
+		},
+		{
+			"error handler",
+			`{`,
+			[]proxy.Option{proxy.WithErrorHandler(proxy.JSONErrorHandler)},
+			http.StatusBadRequest, `{"status":400,"error":"Bad Request"}` + "\n",
+		},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+
+		c.ProxyGraphQLAPI(req, rec, router, tc.opts...)
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.status)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: body = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
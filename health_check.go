@@ -0,0 +1,255 @@
+package api_client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// healthChecker probes the upstreams in the background.
+type healthChecker struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.Mutex
+	healthy map[string]bool
+
+	stop chan struct{}
+	once sync.Once
+
+	// closed once the checks stopped
+	done chan struct{}
+}
+
+func newHealthChecker(path string, interval time.Duration) *healthChecker {
+	if path == "" || interval <= 0 {
+		return nil
+	}
+
+	return &healthChecker{
+		path:     path,
+		interval: interval,
+		healthy:  make(map[string]bool),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// startHealthChecks starts the health checks, unless the client already has
+// some or is closed.
+func (c *Client) startHealthChecks(path string, interval time.Duration) {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+
+	if c.health != nil || c.closed {
+		return
+	}
+
+	if c.health = newHealthChecker(path, interval); c.health != nil {
+		go c.runHealthChecks(c.health)
+	}
+}
+
+func (c *Client) healthChecker() *healthChecker {
+	c.healthMu.Lock()
+	defer c.healthMu.Unlock()
+
+	return c.health
+}
+
+// upstreams returns the base URLs of the upstreams, the balancer endpoints if
+// there's one.
+func (c *Client) upstreams() []*url.URL {
+	if c.LoadBalancer != nil {
+		var urls []*url.URL
+		for _, e := range c.LoadBalancer.Endpoints() {
+			urls = append(urls, e.URL)
+		}
+		return urls
+	}
+
+	if c.APIBaseURL != nil {
+		return []*url.URL{c.APIBaseURL}
+	}
+
+	return nil
+}
+
+func (c *Client) runHealthChecks(h *healthChecker) {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		c.checkUpstreams(h)
+
+		select {
+		case <-ticker.C:
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+func (c *Client) checkUpstreams(h *healthChecker) {
+	var wg sync.WaitGroup
+	for _, u := range c.upstreams() {
+		wg.Add(1)
+		go func(u *url.URL) {
+			defer wg.Done()
+
+			healthy := c.probe(h, u)
+
+			h.mu.Lock()
+			h.healthy[u.String()] = healthy
+			h.mu.Unlock()
+
+			if c.LoadBalancer != nil {
+				c.LoadBalancer.SetHealthy(u, healthy)
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+// probe reports whether the health check path of the upstream responds with
+// a 2xx within the interval.
+func (c *Client) probe(h *healthChecker, base *url.URL) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+	defer cancel()
+
+	// stopped along with the checks
+	go func() {
+		select {
+		case <-h.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	u, err := upstreamURL(base, h.path)
+	if err != nil {
+		return false
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false
+	}
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return false
+	}
+	discardResponse(res)
+
+	return isSuccessStatus(res.StatusCode)
+}
+
+// Healthy reports whether an upstream passed its last health check. It's true
+// before the first check, and without health checks.
+func (c *Client) Healthy() bool {
+	h := c.healthChecker()
+	if h == nil {
+		return true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.healthy) == 0 {
+		return true
+	}
+	for _, healthy := range h.healthy {
+		if healthy {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UpstreamHealth returns the result of the last health check of each
+// upstream, by base URL.
+func (c *Client) UpstreamHealth() map[string]bool {
+	health := make(map[string]bool)
+
+	h := c.healthChecker()
+	if h == nil {
+		return health
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for u, healthy := range h.healthy {
+		health[u] = healthy
+	}
+
+	return health
+}
+
+// HealthHandler responds to liveness and readiness probes of the service,
+// with a 200 while the client is Healthy, and a 503 otherwise. The body is
+// the JSON status of the upstreams.
+func (c *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Status    string          `json:"status"`
+			Upstreams map[string]bool `json:"upstreams"`
+		}{"ok", c.UpstreamHealth()}
+
+		status := http.StatusOK
+		if !c.Healthy() {
+			body.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// Close stops the health checks, without waiting for a probe in progress.
+func (c *Client) Close() error {
+	c.stopHealthChecks()
+
+	return nil
+}
+
+// Shutdown stops the health checks, and waits for them to be done, or ctx to
+// be done.
+func (c *Client) Shutdown(ctx context.Context) error {
+	h := c.stopHealthChecks()
+	if h == nil {
+		return nil
+	}
+
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) stopHealthChecks() *healthChecker {
+	c.healthMu.Lock()
+	c.closed = true
+	h := c.health
+	c.healthMu.Unlock()
+
+	if h != nil {
+		h.once.Do(func() {
+			close(h.stop)
+		})
+	}
+
+	return h
+}
@@ -0,0 +1,114 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/balancer"
+	"github.com/operaads/api-client/proxy"
+)
+
+func newProbedUpstream(name string, healthy *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && atomic.LoadInt32(healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(name))
+	}))
+}
+
+// waitFor polls cond until it's true, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHealthProbeExcludesUnhealthyUpstreams(t *testing.T) {
+	healthyA, healthyB := int32(1), int32(0)
+	a := newProbedUpstream("a", &healthyA)
+	defer a.Close()
+	b := newProbedUpstream("b", &healthyB)
+	defer b.Close()
+
+	lb, err := balancer.NewFromURLs(balancer.RoundRobin, a.URL, b.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(WithLoadBalancer(lb))
+	defer c.Shutdown(context.Background())
+
+	probe := proxy.WithHealthProbe("/health", 10*time.Millisecond)
+	served := func() map[string]int {
+		counts := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			counts[proxyGet(t, c, "/x", nil, probe).Body.String()]++
+		}
+		return counts
+	}
+
+	// starts the probes
+	served()
+	waitFor(t, func() bool {
+		health := c.UpstreamHealth()
+		return len(health) == 2 && !health[b.URL]
+	})
+
+	if counts := served(); counts["a"] != 4 {
+		t.Errorf("served by %v, want only a while b is unhealthy", counts)
+	}
+
+	atomic.StoreInt32(&healthyB, 1)
+	waitFor(t, func() bool {
+		return c.UpstreamHealth()[b.URL]
+	})
+
+	if counts := served(); counts["a"] != 2 || counts["b"] != 2 {
+		t.Errorf("served by %v, want both once b recovered", counts)
+	}
+}
+
+func TestShutdownStopsHealthProbes(t *testing.T) {
+	var probes int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			atomic.AddInt32(&probes, 1)
+		}
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	proxyGet(t, c, "/x", nil, proxy.WithHealthProbe("/health", 5*time.Millisecond))
+	waitFor(t, func() bool {
+		return atomic.LoadInt32(&probes) > 0
+	})
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	stopped := atomic.LoadInt32(&probes)
+
+	time.Sleep(30 * time.Millisecond)
+	if got := atomic.LoadInt32(&probes); got != stopped {
+		t.Errorf("%d probes after Shutdown", got-stopped)
+	}
+
+	// not restarted once shut down
+	proxyGet(t, c, "/x", nil, proxy.WithHealthProbe("/health", 5*time.Millisecond))
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&probes) != stopped {
+		t.Error("health probes restarted after Shutdown")
+	}
+}
@@ -0,0 +1,148 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/operaads/api-client/retry"
+)
+
+const latencyWindowSize = 256
+
+// latencyWindow keeps the recent response times of the client.
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (w *latencyWindow) quantile(q float64) (time.Duration, bool) {
+	w.mu.Lock()
+	samples := make([]time.Duration, len(w.samples))
+	copy(samples, w.samples)
+	w.mu.Unlock()
+
+	if len(samples) < retry.DefaultHedgeMinSamples {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+
+	i := int(q * float64(len(samples)))
+	if i >= len(samples) {
+		i = len(samples) - 1
+	}
+
+	return samples[i], true
+}
+
+// hedgeTransport sends a second request when the first one is slow, and
+// returns the first response.
+type hedgeTransport struct {
+	base      http.RoundTripper
+	policy    *retry.HedgePolicy
+	latencies *latencyWindow
+}
+
+type hedgeResult struct {
+	res     *http.Response
+	err     error
+	attempt int
+	elapsed time.Duration
+}
+
+func (t *hedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if !replayable || !(&retry.Policy{}).RetriesMethod(req.Method) {
+		return t.base.RoundTrip(req)
+	}
+
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func(r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		cancels = append(cancels, cancel)
+		attempt := len(cancels) - 1
+
+		go func() {
+			start := time.Now()
+			res, err := t.base.RoundTrip(r.WithContext(ctx))
+			results <- hedgeResult{res: res, err: err, attempt: attempt, elapsed: time.Since(start)}
+		}()
+	}
+
+	send(req)
+	pending := 1
+
+	timer := time.NewTimer(t.delay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if hedgeReq, ok := replayRequest(req); ok {
+				send(hedgeReq)
+				pending++
+			}
+		case r := <-results:
+			pending--
+
+			if r.err != nil {
+				cancels[r.attempt]()
+				if pending == 0 {
+					return nil, r.err
+				}
+				continue
+			}
+
+			t.latencies.add(r.elapsed)
+
+			// the loser is cancelled, and its response discarded
+			for i, cancel := range cancels {
+				if i != r.attempt {
+					cancel()
+				}
+			}
+			for ; pending > 0; pending-- {
+				go func() {
+					if loser := <-results; loser.err == nil {
+						loser.res.Body.Close()
+					}
+				}()
+			}
+
+			r.res.Body = onClose(r.res.Body, cancels[r.attempt])
+
+			return r.res, nil
+		}
+	}
+}
+
+func (t *hedgeTransport) delay() time.Duration {
+	delay := t.policy.Delay
+	if t.policy.Quantile > 0 {
+		if d, ok := t.latencies.quantile(t.policy.Quantile); ok && d > delay {
+			delay = d
+		}
+	}
+
+	return delay
+}
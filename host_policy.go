@@ -0,0 +1,149 @@
+package api_client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/operaads/api-client/breaker"
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/retry"
+)
+
+type hostPolicyTransport struct {
+	base     http.RoundTripper
+	policies map[string]proxy.HostPolicy
+	opt      *proxy.Options
+	httpReq  *http.Request
+}
+
+func (t *hostPolicyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy, ok := t.policies[req.URL.Host]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	retries := policy.Retries
+	if !(&retry.Policy{RetryNonIdempotent: policy.RetryNonIdempotent}).RetriesMethod(req.Method) {
+		retries = 0
+	}
+
+	var attempts []proxy.Attempt
+
+	// the last 429 or 503 response, returned if it can't be retried
+	var lastRes *http.Response
+
+	for i := 0; i <= retries; i++ {
+		attemptReq := req
+		if i > 0 {
+			// the body was consumed by the previous attempt
+			if req.Body != nil && req.Body != http.NoBody {
+				if req.GetBody == nil {
+					break
+				}
+
+				body, err := req.GetBody()
+				if err != nil {
+					break
+				}
+
+				attemptReq = req.Clone(req.Context())
+				attemptReq.Body = body
+			}
+
+			delay := retryBackoff(i, policy.RetryBackoff, policy.RetryMaxBackoff)
+			if lastRes != nil {
+				if retryAfter, ok := parseRetryAfter(lastRes.Header.Get("Retry-After"), time.Now()); ok && retryAfter > delay {
+					delay = retryAfter
+				}
+			}
+			if !sleepContext(req.Context(), delay) {
+				if attemptReq != req {
+					attemptReq.Body.Close()
+				}
+				break
+			}
+
+			if lastRes != nil {
+				discardResponse(lastRes)
+				lastRes = nil
+			}
+		}
+
+		res, err := t.roundTrip(attemptReq, policy)
+		if err == nil {
+			if !isRetryableStatus(res.StatusCode) {
+				return res, nil
+			}
+
+			lastRes = res
+			attempts = append(attempts, proxy.Attempt{
+				Upstream: req.URL.Host,
+				Err:      fmt.Errorf("upstream responded %s", res.Status),
+			})
+			continue
+		}
+
+		attempts = append(attempts, proxy.Attempt{Upstream: req.URL.Host, Err: err})
+
+		// don't retry once the request is cancelled or the breaker is open
+		if req.Context().Err() != nil || err == breaker.ErrOpen {
+			break
+		}
+	}
+
+	if lastRes != nil {
+		return lastRes, nil
+	}
+
+	if len(attempts) == 1 {
+		return nil, attempts[0].Err
+	}
+
+	return nil, &proxy.ExhaustedError{Attempts: attempts}
+}
+
+func (t *hostPolicyTransport) roundTrip(req *http.Request, policy proxy.HostPolicy) (*http.Response, error) {
+	if policy.Breaker != nil {
+		before := policy.Breaker.State()
+		defer func() {
+			if after := policy.Breaker.State(); after != before {
+				t.opt.Notify(proxy.Event{
+					Type:         proxy.EventTypeBreakerStateChange,
+					Request:      t.httpReq,
+					Upstream:     req.URL.Host,
+					BreakerState: after,
+				})
+			}
+		}()
+
+		if err := policy.Breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	clientCtx := req.Context()
+	cancel := context.CancelFunc(func() {})
+	if policy.Timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(req.Context(), policy.Timeout)
+		req = req.WithContext(ctx)
+	}
+
+	res, err := t.base.RoundTrip(req)
+
+	if policy.Breaker != nil {
+		// the policy timeout is a failure, unlike the client cancelling
+		reportBreaker(policy.Breaker, clientCtx, res, err)
+	}
+
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	res.Body = onClose(res.Body, cancel)
+
+	return res, nil
+}
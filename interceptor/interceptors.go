@@ -1,6 +1,10 @@
 package interceptor
 
 import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
@@ -10,10 +14,54 @@ type URLInterceptor func(*url.URL)
 
 type RequestInterceptor func(*http.Request)
 
-type ResponseInterceptor func(response *http.Response)
+// QueryInterceptor returns the query parameters of the proxied URL.
+type QueryInterceptor func(url.Values) url.Values
+
+// RequestRewriter returns the body replacing the request body, or nil to keep
+// it.
+type RequestRewriter func(*http.Request) (io.Reader, error)
+
+// ResponseInterceptor can change or replace the upstream response before
+// it's written. A replaced body is closed along with the new one, and the
+// content length must be updated, -1 if unknown.
+type ResponseInterceptor func(response *http.Response) (*http.Response, error)
+
+// ResponseBodyTransformer returns the body to write instead of the given one,
+// e.g. a reader rewriting it as it's read.
+type ResponseBodyTransformer func(io.Reader) io.Reader
 
 type JSONInterceptor func(interface{}) (interface{}, error)
 
+type JSONArrayElementInterceptor func(json.RawMessage) (json.RawMessage, error)
+
+// JSONStreamInterceptor reads the JSON body from the decoder and writes the
+// transformed body to the encoder, without holding the whole body in memory.
+type JSONStreamInterceptor func(*json.Decoder, *json.Encoder) error
+
+// CSVInterceptor transforms a CSV row. It's called with a nil header for the
+// header row itself.
+type CSVInterceptor func(header []string, row []string) ([]string, error)
+
+type ErrorResponseInterceptor func(status int, body interface{}) (int, interface{})
+
+// ResponseStatusInterceptor returns the status code written to the client, or
+// 0 to keep the given one. The response headers can be changed in place.
+type ResponseStatusInterceptor func(status int, header http.Header) int
+
 type FormInterceptor func(url.Values) (url.Values, error)
 
+// ContextRequestInterceptor, ContextJSONInterceptor and ContextFormInterceptor
+// are like RequestInterceptor, JSONInterceptor and FormInterceptor, and are
+// also given the incoming request context.
+type ContextRequestInterceptor func(context.Context, *http.Request)
+
+type ContextJSONInterceptor func(context.Context, interface{}) (interface{}, error)
+
+type ContextFormInterceptor func(context.Context, url.Values) (url.Values, error)
+
 type MultipartFormInterceptor func(*multipart.Writer) error
+
+// XMLInterceptor transforms an XML document, reading it from the decoder and
+// writing it to the encoder. The XML declaration of the document, if any, is
+// written to the encoder beforehand, and the decoder starts after it.
+type XMLInterceptor func(*xml.Decoder, *xml.Encoder) error
@@ -0,0 +1,56 @@
+package api_client
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/operaads/api-client/request"
+)
+
+type DecodeOption func(*json.Decoder)
+
+// DecodeUseNumber decodes JSON numbers into json.Number instead of float64,
+// so that large integers don't lose precision.
+func DecodeUseNumber() DecodeOption {
+	return func(d *json.Decoder) {
+		d.UseNumber()
+	}
+}
+
+// DoJSONRequest performs the request and decodes the JSON response body into
+// out. A non-2xx response is returned as *APIError.
+func (c *Client) DoJSONRequest(req *request.APIRequest, out interface{}, opts ...DecodeOption) error {
+	res, err := c.DoAPIRequest(req)
+	if err != nil {
+		return err
+	}
+
+	return decodeJSONResponse(res.Response, out, opts)
+}
+
+func decodeJSONResponse(res *http.Response, out interface{}, opts []DecodeOption) error {
+	if err := checkResponseStatus(res); err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	reader, err := decodeResponseBody(res.Body, res.Header.Get("Content-Encoding"))
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		_, err := io.Copy(ioutil.Discard, reader)
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	for _, o := range opts {
+		o(decoder)
+	}
+
+	return decoder.Decode(out)
+}
@@ -0,0 +1,48 @@
+package api_client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/operaads/api-client/request"
+)
+
+// DoJSON performs the request and decodes the JSON response body into a T.
+// A non-2xx response is returned as *APIError.
+func DoJSON[T any](c *Client, req *request.APIRequest, opts ...DecodeOption) (T, error) {
+	res, err := c.DoAPIRequest(req)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return DecodeJSONResponse[T](res.Response, opts...)
+}
+
+// DecodeJSONResponse decodes the JSON body of res into a T, and closes it. The
+// body is decompressed when it's gzip encoded, and a non-2xx response is
+// returned as *APIError.
+func DecodeJSONResponse[T any](res *http.Response, opts ...DecodeOption) (T, error) {
+	var out T
+	err := decodeJSONResponse(res, &out, opts)
+
+	return out, err
+}
+
+// DecodeJSONErrorBody decodes the JSON body of an *APIError in err into an E.
+// It reports false when err isn't an *APIError, or its body isn't an E.
+func DecodeJSONErrorBody[E any](err error) (E, bool) {
+	var body E
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return body, false
+	}
+
+	if err := json.Unmarshal(apiErr.Body, &body); err != nil {
+		return body, false
+	}
+
+	return body, true
+}
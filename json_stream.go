@@ -0,0 +1,91 @@
+package api_client
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func streamJSONArray(r io.Reader, w io.Writer, opt *proxy.Options) error {
+	br := bufio.NewReader(r)
+
+	isArray, err := peekJSONArray(br)
+	if err != nil {
+		return err
+	}
+	if !isArray {
+		buf, err := transformJSON(br, opt.ResponseJSONInterceptor, opt.ResponseKeyCase, opt)
+		if err != nil {
+			return err
+		}
+
+		_, err = buf.WriteTo(w)
+		return err
+	}
+
+	decoder := json.NewDecoder(br)
+
+	// consume the opening bracket
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	first := true
+	for decoder.More() {
+		var elem json.RawMessage
+		if err := decoder.Decode(&elem); err != nil {
+			return err
+		}
+
+		newElem, err := opt.ResponseJSONArrayInterceptor(elem)
+		if err != nil {
+			return err
+		}
+		if newElem == nil {
+			continue
+		}
+
+		if !first {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		if _, err := w.Write(newElem); err != nil {
+			return err
+		}
+	}
+
+	// consume the closing bracket
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "]\n")
+	return err
+}
+
+func peekJSONArray(br *bufio.Reader) (bool, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return false, err
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			if _, err := br.Discard(1); err != nil {
+				return false, err
+			}
+		default:
+			return b[0] == '[', nil
+		}
+	}
+}
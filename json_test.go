@@ -0,0 +1,121 @@
+package api_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/request"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDoJSONRequest(t *testing.T) {
+	body := gzipBytes(t, []byte(`{"id":12345678901234567}`))
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	var out struct {
+		ID json.Number `json:"id"`
+	}
+	if err := c.DoJSONRequest(request.NewAPIRequest(http.MethodGet, "/x", nil), &out, DecodeUseNumber()); err != nil {
+		t.Fatalf("DoJSONRequest: %v", err)
+	}
+	if out.ID != "12345678901234567" {
+		t.Errorf("id = %s, want 12345678901234567", out.ID)
+	}
+}
+
+func TestDoJSONRequestReadsBodyAfterHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items":[`))
+		w.(http.Flusher).Flush()
+
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`1,2]}`))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL), WithRequestTimeout(time.Second))
+
+	var out struct {
+		Items []int `json:"items"`
+	}
+	if err := c.DoJSONRequest(request.NewAPIRequest(http.MethodGet, "/x", nil), &out); err != nil {
+		t.Fatalf("DoJSONRequest: %v", err)
+	}
+	if len(out.Items) != 2 {
+		t.Errorf("items = %v, want [1 2]", out.Items)
+	}
+}
+
+func TestDoJSONRequestAPIError(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     string
+	}{
+		{"plain", "", []byte(`{"error":"not found"}`), `{"error":"not found"}`},
+		{"gzip", "gzip", gzipBytes(t, []byte(`{"error":"not found"}`)), `{"error":"not found"}`},
+		{"empty gzip", "gzip", nil, ""},
+		{"mislabeled gzip", "gzip", []byte("bad gateway"), "bad gateway"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.encoding != "" {
+					w.Header().Set("Content-Encoding", tc.encoding)
+				}
+				w.WriteHeader(http.StatusNotFound)
+				w.Write(tc.body)
+			}))
+			defer upstream.Close()
+
+			c := NewClient(WithBaseURL(upstream.URL))
+
+			// the transport doesn't decompress the body itself then
+			acceptGzip := request.WithRequestInterceptors(func(r *http.Request) {
+				r.Header.Set("Accept-Encoding", "gzip")
+			})
+
+			var out interface{}
+			err := c.DoJSONRequest(request.NewAPIRequest(http.MethodGet, "/x", nil, acceptGzip), &out)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != http.StatusNotFound {
+				t.Errorf("status = %d, want 404", apiErr.StatusCode)
+			}
+			if string(apiErr.Body) != tc.want {
+				t.Errorf("body = %q, want %q", apiErr.Body, tc.want)
+			}
+		})
+	}
+}
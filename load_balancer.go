@@ -0,0 +1,58 @@
+package api_client
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/operaads/api-client/balancer"
+	"github.com/operaads/api-client/proxy"
+)
+
+// balancerTransport sends the requests to the base URL host to the endpoints
+// picked by the balancer.
+type balancerTransport struct {
+	base     http.RoundTripper
+	balancer *balancer.Balancer
+	host     string
+}
+
+func (t *balancerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+
+	endpoint, done := t.balancer.Pick()
+
+	u := *req.URL
+	u.Scheme = endpoint.Scheme
+	u.Host = endpoint.Host
+
+	r := new(http.Request)
+	*r = *req
+	r.URL = &u
+	if r.Host == req.URL.Host {
+		r.Host = ""
+	}
+
+	res, err := t.base.RoundTrip(r)
+	if err != nil {
+		if req.Context().Err() != nil {
+			// cancelled, the endpoint isn't to blame
+			done(nil, 0)
+		} else {
+			done(err, 0)
+		}
+
+		var exhaustedErr *proxy.ExhaustedError
+		if !errors.As(err, &exhaustedErr) {
+			// tell which endpoint failed, retries would report the base URL
+			// host otherwise
+			err = &proxy.ExhaustedError{Attempts: []proxy.Attempt{{Upstream: endpoint.Host, Err: err}}}
+		}
+		return nil, err
+	}
+
+	done(nil, res.StatusCode)
+
+	return res, nil
+}
@@ -0,0 +1,63 @@
+package api_client
+
+import (
+	"mime"
+	"strings"
+)
+
+// mediaType returns the lowercased media type of a Content-Type value,
+// without its parameters.
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// keep what comes before invalid parameters
+		mt = strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	}
+
+	return mt
+}
+
+// matchesContentType reports whether the Content-Type value is unset, or its
+// media type matches.
+func matchesContentType(contentType string, match func(mt string) bool) bool {
+	return contentType == "" || match(mediaType(contentType))
+}
+
+func isJSONMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+func isXMLMediaType(mt string) bool {
+	return mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml")
+}
+
+func isCSVMediaType(mt string) bool {
+	return mt == "text/csv" || mt == "application/csv"
+}
+
+// isCompressedMediaType reports whether content of the media type is
+// usually compressed already, so not worth compressing again.
+func isCompressedMediaType(mt string) bool {
+	switch {
+	case strings.HasPrefix(mt, "image/"):
+		return mt != "image/svg+xml" && mt != "image/bmp"
+	case strings.HasPrefix(mt, "video/"), strings.HasPrefix(mt, "audio/"):
+		return true
+	}
+
+	switch mt {
+	case "application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/x-bzip2",
+		"application/x-xz",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+		"application/zstd",
+		"font/woff",
+		"font/woff2":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+package api_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func TestMediaType(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		mt          string
+		json        bool
+		compressed  bool
+	}{
+		{"application/json", "application/json", true, false},
+		{"application/json;charset=UTF-8", "application/json", true, false},
+		{"Application/JSON; charset=utf-8", "application/json", true, false},
+		{" application/json ; charset=\"utf-8\"", "application/json", true, false},
+		{"application/problem+json", "application/problem+json", true, false},
+		{"application/vnd.api+json; ext=bulk", "application/vnd.api+json", true, false},
+		{"application/json; charset", "application/json", true, false},
+		{"application/jsonp", "application/jsonp", false, false},
+		{"text/json-seq", "text/json-seq", false, false},
+		{"text/html; charset=ISO-8859-1", "text/html", false, false},
+		{"image/png", "image/png", false, true},
+		{"image/svg+xml", "image/svg+xml", false, false},
+		{"application/GZIP", "application/gzip", false, true},
+		{"", "", false, false},
+	} {
+		mt := mediaType(tc.contentType)
+		if mt != tc.mt {
+			t.Errorf("mediaType(%q) = %q, want %q", tc.contentType, mt, tc.mt)
+		}
+		if got := isJSONMediaType(mt); got != tc.json {
+			t.Errorf("isJSONMediaType(%q) = %v, want %v", mt, got, tc.json)
+		}
+		if got := isCompressedMediaType(mt); got != tc.compressed {
+			t.Errorf("isCompressedMediaType(%q) = %v, want %v", mt, got, tc.compressed)
+		}
+	}
+}
+
+func TestProxyJSONInterceptorContentTypes(t *testing.T) {
+	for _, tc := range []struct {
+		contentType string
+		intercepted bool
+	}{
+		{"application/json;charset=UTF-8", true},
+		{"APPLICATION/JSON", true},
+		{"application/hal+json; charset=utf-8", true},
+		{"text/plain; charset=utf-8", false},
+	} {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.contentType)
+			w.Write([]byte(`{"a":1}`))
+		}))
+
+		c := NewClient(WithBaseURL(upstream.URL))
+		intercepted := false
+		opt := proxy.WithResponseJSONInterceptor(func(v interface{}) (interface{}, error) {
+			intercepted = true
+			return v, nil
+		})
+
+		rec := proxyGet(t, c, "/x", nil, opt)
+		upstream.Close()
+
+		if intercepted != tc.intercepted {
+			t.Errorf("%q: intercepted = %v, want %v", tc.contentType, intercepted, tc.intercepted)
+		}
+		if tc.intercepted && rec.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+			t.Errorf("%q: Content-Type = %q", tc.contentType, rec.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// Collector records the outgoing requests of a client. The path is the path
+// template set on the request if any, or the request path otherwise.
+type Collector interface {
+	// RequestStarted is called right before the request is sent.
+	RequestStarted(method, path string)
+
+	// RequestDone is called once the response headers are received, or the
+	// request failed, with a 0 status.
+	RequestDone(method, path string, status int, duration time.Duration)
+}
+
+// StatusClass returns the class of the status code, like "2xx", or "error"
+// for a failed request.
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "error"
+	}
+
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,22 @@
+module github.com/operaads/api-client/metrics/prometheus
+
+go 1.18
+
+require (
+	github.com/operaads/api-client v0.0.0-00010101000000-000000000000
+	github.com/prometheus/client_golang v1.8.0
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.14.0 // indirect
+	github.com/prometheus/procfs v0.2.0 // indirect
+	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
+	google.golang.org/protobuf v1.25.0 // indirect
+)
+
+replace github.com/operaads/api-client => ../..
@@ -0,0 +1,72 @@
+package prometheus
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/operaads/api-client/metrics"
+)
+
+// Collector is a metrics.Collector exposing the requests as Prometheus
+// metrics. It must be registered to be scraped.
+type Collector struct {
+	requests *prom.CounterVec
+	inFlight *prom.GaugeVec
+	duration *prom.HistogramVec
+}
+
+var _ metrics.Collector = (*Collector)(nil)
+
+// NewCollector creates the collector, with the metric names prefixed by the
+// namespace, e.g. "gateway_upstream_requests_total". The histogram uses the
+// default buckets when none are given.
+func NewCollector(namespace string, buckets ...float64) *Collector {
+	if len(buckets) == 0 {
+		buckets = prom.DefBuckets
+	}
+
+	return &Collector{
+		requests: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "requests_total",
+			Help:      "Upstream requests by method, path and status class.",
+		}, []string{"method", "path", "code"}),
+		inFlight: prom.NewGaugeVec(prom.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "requests_in_flight",
+			Help:      "Upstream requests waiting for a response.",
+		}, []string{"method", "path"}),
+		duration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "upstream",
+			Name:      "request_duration_seconds",
+			Help:      "Time until the upstream response headers are received.",
+			Buckets:   buckets,
+		}, []string{"method", "path"}),
+	}
+}
+
+func (c *Collector) RequestStarted(method, path string) {
+	c.inFlight.WithLabelValues(method, path).Inc()
+}
+
+func (c *Collector) RequestDone(method, path string, status int, duration time.Duration) {
+	c.inFlight.WithLabelValues(method, path).Dec()
+	c.requests.WithLabelValues(method, path, metrics.StatusClass(status)).Inc()
+	c.duration.WithLabelValues(method, path).Observe(duration.Seconds())
+}
+
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	c.requests.Describe(ch)
+	c.inFlight.Describe(ch)
+	c.duration.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.requests.Collect(ch)
+	c.inFlight.Collect(ch)
+	c.duration.Collect(ch)
+}
@@ -0,0 +1,53 @@
+package api_client
+
+import (
+	"github.com/operaads/api-client/request"
+	"github.com/operaads/api-client/response"
+)
+
+// Doer sends API requests, like Client.DoAPIRequest.
+type Doer interface {
+	Do(req *request.APIRequest) (*response.APIResponse, error)
+}
+
+type DoerFunc func(req *request.APIRequest) (*response.APIResponse, error)
+
+func (f DoerFunc) Do(req *request.APIRequest) (*response.APIResponse, error) {
+	return f(req)
+}
+
+// Middleware wraps the Doer sending the requests, e.g. to log them, or change
+// them before they're sent.
+type Middleware func(next Doer) Doer
+
+// Use adds middlewares around the requests of the client, including proxied
+// ones. The first one added is the outermost. Middlewares must be added before
+// the client is used.
+func (c *Client) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares, middlewares...)
+}
+
+func (c *Client) doer() Doer {
+	var d Doer = DoerFunc(c.sendAPIRequest)
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		d = c.middlewares[i](d)
+	}
+
+	return d
+}
+
+// errorOnNon2xx returns non-2xx responses as *APIError.
+func errorOnNon2xx(next Doer) Doer {
+	return DoerFunc(func(req *request.APIRequest) (*response.APIResponse, error) {
+		res, err := next.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkResponseStatus(res.Response); err != nil {
+			return nil, err
+		}
+
+		return res, nil
+	})
+}
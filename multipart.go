@@ -0,0 +1,218 @@
+package api_client
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// defaultMultipartMaxMemory is the multipart body size kept in memory when
+// MaxUploadSize isn't set, as for http.Request.FormFile.
+const defaultMultipartMaxMemory = 32 << 20
+
+// copyMultipartRequest copies the parts of the request into a new multipart
+// body, kept in memory up to MaxUploadSize, then spilled to a file in the
+// multipart storage dir, or rejected for in-memory multipart.
+func copyMultipartRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
+	mr, err := req.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	maxMemory := opt.MaxUploadSize
+	if maxMemory <= 0 {
+		maxMemory = defaultMultipartMaxMemory
+	}
+
+	body := &spillBuffer{
+		dir:       opt.MultipartStorageDir,
+		maxMemory: maxMemory,
+		inMemory:  opt.MultipartInMemory,
+	}
+	multiWriter := multipart.NewWriter(body)
+
+	if err := copyMultipartParts(mr, multiWriter, opt); err != nil {
+		body.Close()
+		return nil, "", err
+	}
+	if opt.RequestMultipartFormInterceptor != nil {
+		if err := opt.RequestMultipartFormInterceptor(multiWriter); err != nil {
+			body.Close()
+			return nil, "", err
+		}
+	}
+	if err := multiWriter.Close(); err != nil {
+		body.Close()
+		return nil, "", err
+	}
+
+	reader, err := body.reader()
+	if err != nil {
+		body.Close()
+		return nil, "", err
+	}
+
+	return reader, multiWriter.FormDataContentType(), nil
+}
+
+// streamMultipartRequest copies the parts of the request into a new multipart
+// body as it's sent, so that only a part chunk is held in memory. A failure
+// to read a part, or a body larger than MaxUploadSize, fails the upstream
+// request. The multipart form interceptor is run beforehand, so that its
+// error fails the request before it's sent, and what it writes is appended
+// to the parts.
+func streamMultipartRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
+	src := req
+	if opt.MaxUploadSize > 0 {
+		src = req.WithContext(req.Context())
+		src.Body = struct {
+			io.Reader
+			io.Closer
+		}{&maxBytesReader{r: req.Body, n: opt.MaxUploadSize, err: proxy.ErrRequestTooLarge}, req.Body}
+	}
+
+	mr, err := src.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	intercepted, err := interceptedMultipartParts(opt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pr, pw := io.Pipe()
+	multiWriter := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(streamMultipartParts(mr, intercepted, multiWriter, opt))
+	}()
+
+	return pr, multiWriter.FormDataContentType(), nil
+}
+
+// interceptedMultipartParts returns the parts written by the multipart form
+// interceptor, or nil without one.
+func interceptedMultipartParts(opt *proxy.Options) (*multipart.Reader, error) {
+	if opt.RequestMultipartFormInterceptor == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	multiWriter := multipart.NewWriter(&buf)
+
+	if err := opt.RequestMultipartFormInterceptor(multiWriter); err != nil {
+		return nil, err
+	}
+	if err := multiWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return multipart.NewReader(&buf, multiWriter.Boundary()), nil
+}
+
+func streamMultipartParts(mr, intercepted *multipart.Reader, multiWriter *multipart.Writer, opt *proxy.Options) error {
+	if err := copyMultipartParts(mr, multiWriter, opt); err != nil {
+		return err
+	}
+	if intercepted != nil {
+		if err := copyMultipartParts(intercepted, multiWriter, opt); err != nil {
+			return err
+		}
+	}
+
+	return multiWriter.Close()
+}
+
+func copyMultipartParts(mr *multipart.Reader, multiWriter *multipart.Writer, opt *proxy.Options) error {
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		writer, err := multiWriter.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if _, err := copyBuffer(writer, part, opt.CopyBufferSize); err != nil {
+			return &proxy.MultipartPartError{
+				FormName: part.FormName(),
+				FileName: part.FileName(),
+				Err:      err,
+			}
+		}
+	}
+}
+
+// spillBuffer is a buffer that moves its content to a temp file once it
+// grows past maxMemory. Closing it removes the file.
+type spillBuffer struct {
+	buf       bytes.Buffer
+	file      *os.File
+	dir       string
+	maxMemory int64
+	inMemory  bool
+}
+
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	if b.file == nil && int64(b.buf.Len()+len(p)) > b.maxMemory {
+		if b.inMemory {
+			return 0, proxy.ErrRequestTooLarge
+		}
+
+		f, err := ioutil.TempFile(b.dir, "multipart-")
+		if err != nil {
+			return 0, err
+		}
+		b.file = f
+
+		if _, err := b.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+
+	if b.file != nil {
+		return b.file.Write(p)
+	}
+
+	return b.buf.Write(p)
+}
+
+// reader returns the buffer content. It's the in-memory buffer, so that its
+// length is known, or the buffer itself reading the file.
+func (b *spillBuffer) reader() (io.Reader, error) {
+	if b.file == nil {
+		return &b.buf, nil
+	}
+
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *spillBuffer) Read(p []byte) (int, error) {
+	return b.file.Read(p)
+}
+
+func (b *spillBuffer) Close() error {
+	if b.file == nil {
+		return nil
+	}
+
+	err := b.file.Close()
+	if rmErr := os.Remove(b.file.Name()); err == nil {
+		err = rmErr
+	}
+
+	return err
+}
@@ -0,0 +1,149 @@
+package api_client
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func newMultipartRequest(t *testing.T, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	return req
+}
+
+func TestStreamMultipartRequest(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var fields []string
+		for k, vv := range r.MultipartForm.Value {
+			fields = append(fields, k+"="+strings.Join(vv, ","))
+		}
+		sort.Strings(fields)
+		w.Write([]byte(strings.Join(fields, "&")))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	errIntercept := errors.New("intercept failed")
+
+	for _, tc := range []struct {
+		name  string
+		opts  []proxy.Option
+		body  string
+		err   error
+		sends bool
+	}{
+		{
+			"interceptor appends",
+			[]proxy.Option{proxy.WithRequestMultipartFormInterceptor(func(w *multipart.Writer) error {
+				return w.WriteField("extra", "1")
+			})},
+			"a=1&extra=1", nil, true,
+		},
+		{
+			"interceptor fails",
+			[]proxy.Option{proxy.WithRequestMultipartFormInterceptor(func(w *multipart.Writer) error {
+				return errIntercept
+			})},
+			"", errIntercept, false,
+		},
+		{
+			"too large",
+			[]proxy.Option{proxy.WithMaxUploadSize(16)},
+			"Request Entity Too Large\n", proxy.ErrRequestTooLarge, true,
+		},
+	} {
+		atomic.StoreInt32(&hits, 0)
+
+		rec := httptest.NewRecorder()
+		err := c.ProxyAPI("", "", newMultipartRequest(t, map[string]string{"a": "1"}), rec, proxy.RequestBodyTypeMultipartForm, tc.opts...)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+		}
+		if got := rec.Body.String(); got != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.name, got, tc.body)
+		}
+		if !tc.sends && atomic.LoadInt32(&hits) != 0 {
+			t.Errorf("%s: the upstream request was sent", tc.name)
+		}
+	}
+}
+
+func TestMultipartStorageRemovesTempFiles(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strconv.Itoa(len(r.FormValue("a")))))
+	}))
+	defer upstream.Close()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	errIntercept := errors.New("intercept failed")
+	value := strings.Repeat("x", 4096)
+
+	for _, tc := range []struct {
+		name    string
+		baseURL string
+		opts    []proxy.Option
+		body    string
+		fails   bool
+	}{
+		{"sent", upstream.URL, nil, "4096", false},
+		{"interceptor fails", upstream.URL, []proxy.Option{proxy.WithRequestMultipartFormInterceptor(func(w *multipart.Writer) error {
+			return errIntercept
+		})}, "", true},
+		{"upstream fails", closed.URL, nil, "", true},
+	} {
+		dir := t.TempDir()
+		c := NewClient(WithBaseURL(tc.baseURL))
+		opts := append([]proxy.Option{proxy.WithMaxUploadSize(1024), proxy.WithMultipartStorage(dir)}, tc.opts...)
+
+		rec := httptest.NewRecorder()
+		err := c.ProxyAPI("", "", newMultipartRequest(t, map[string]string{"a": value}), rec, proxy.RequestBodyTypeMultipartForm, opts...)
+		if (err != nil) != tc.fails {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+		if got := rec.Body.String(); !tc.fails && got != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.name, got, tc.body)
+		}
+
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 0 {
+			t.Errorf("%s: %d files left in the storage dir", tc.name, len(files))
+		}
+	}
+}
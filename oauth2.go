@@ -0,0 +1,92 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauth2Transport authorizes the requests with a client credentials token,
+// cached until it expires. A request getting a 401 is sent again once with a
+// new token, if its body can be replayed.
+type oauth2Transport struct {
+	base   http.RoundTripper
+	config *clientcredentials.Config
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+func (t *oauth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.getToken(req.Context())
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	res, err := t.base.RoundTrip(authorizeRequest(req, token))
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	next, ok := replayRequest(req)
+	if !ok {
+		return res, nil
+	}
+
+	t.invalidate(token)
+
+	if token, err = t.getToken(req.Context()); err != nil {
+		if next != req {
+			next.Body.Close()
+		}
+		return res, nil
+	}
+
+	discardResponse(res)
+
+	return t.base.RoundTrip(authorizeRequest(next, token))
+}
+
+func (t *oauth2Transport) getToken(ctx context.Context) (*oauth2.Token, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token.Valid() {
+		return t.token, nil
+	}
+
+	// the token endpoint is reached with the client's transport
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: t.base})
+
+	token, err := t.config.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.token = token
+
+	return token, nil
+}
+
+// invalidate drops the token if it's still the cached one, so that it isn't
+// refreshed twice by concurrent requests.
+func (t *oauth2Transport) invalidate(token *oauth2.Token) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token == token {
+		t.token = nil
+	}
+}
+
+func authorizeRequest(req *http.Request, token *oauth2.Token) *http.Request {
+	r := req.Clone(req.Context())
+	token.SetAuthHeader(r)
+
+	return r
+}
@@ -1,25 +1,217 @@
 package api_client
 
 import (
-	"github.com/operaads/api-client/interceptor"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
 	"time"
+
+	"github.com/operaads/api-client/balancer"
+	"github.com/operaads/api-client/breaker"
+	"github.com/operaads/api-client/interceptor"
+	"github.com/operaads/api-client/metrics"
+	"github.com/operaads/api-client/retry"
+	"github.com/operaads/api-client/tracing"
+	"golang.org/x/oauth2/clientcredentials"
 )
 
 type Options struct {
+	BaseURL        string
 	RequestTimeout time.Duration
 
+	HTTPClient     *http.Client
+	Transport      http.RoundTripper
+	DefaultHeaders http.Header
+
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	DisableKeepAlives   bool
+
+	TransportConfigs []func(*http.Transport)
+
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+
+	TLSConfig *tls.Config
+
 	URLInterceptor     interceptor.URLInterceptor
 	RequestInterceptor interceptor.RequestInterceptor
+
+	RetryPolicy  *retry.Policy
+	Breakers     *breaker.Group
+	LoadBalancer *balancer.Balancer
+	Metrics      metrics.Collector
+	Tracer       tracing.Tracer
+
+	OAuth2 *clientcredentials.Config
+
+	ErrorOnNon2xx bool
+
+	RateLimits        []RateLimit
+	RateLimitFailFast bool
+	QuotaHeaders      *QuotaHeaders
+
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+
+	Middlewares []Middleware
 }
 
 type Option func(*Options)
 
+func WithBaseURL(baseURL string) Option {
+	return func(o *Options) {
+		o.BaseURL = baseURL
+	}
+}
+
 func WithRequestTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
 		o.RequestTimeout = timeout
 	}
 }
 
+// WithHTTPClient sets the http client used for all outgoing requests.
+// It takes precedence over WithTransport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *Options) {
+		o.HTTPClient = client
+	}
+}
+
+// WithTransport sets the round tripper of the outgoing requests, e.g. a
+// custom *http.Transport. It takes precedence over the connection pool
+// options.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *Options) {
+		o.Transport = transport
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the max idle (keep-alive) connections kept per
+// host by the client's transport. Like the other connection pool options, it
+// is ignored when WithHTTPClient or WithTransport is used, and has no effect
+// if the transport disables keep-alives, since connections are then never
+// reused.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(o *Options) {
+		o.MaxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxIdleConns sets the max idle connections kept across all hosts.
+func WithMaxIdleConns(n int) Option {
+	return func(o *Options) {
+		o.MaxIdleConns = n
+	}
+}
+
+func WithMaxConnsPerHost(n int) Option {
+	return func(o *Options) {
+		o.MaxConnsPerHost = n
+	}
+}
+
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.IdleConnTimeout = timeout
+	}
+}
+
+// WithKeepAlive sets the period of the TCP keep-alive probes of the upstream
+// connections, 30s by default. A negative period disables them.
+func WithKeepAlive(period time.Duration) Option {
+	return func(o *Options) {
+		o.KeepAlive = period
+	}
+}
+
+// WithDisableKeepAlives closes the upstream connections after each request,
+// instead of reusing them.
+func WithDisableKeepAlives() Option {
+	return func(o *Options) {
+		o.DisableKeepAlives = true
+	}
+}
+
+// WithTransportConfig calls configure with the client's transport, after the
+// other connection pool options are applied, to tune the settings without an
+// option. Like them, it's ignored when WithHTTPClient or WithTransport is used.
+func WithTransportConfig(configure func(*http.Transport)) Option {
+	return func(o *Options) {
+		configs := make([]func(*http.Transport), len(o.TransportConfigs), len(o.TransportConfigs)+1)
+		copy(configs, o.TransportConfigs)
+
+		o.TransportConfigs = append(configs, configure)
+	}
+}
+
+// WithDialTimeout bounds how long connecting to the upstream takes. Like with
+// WithTLSHandshakeTimeout and WithResponseHeaderTimeout, it's set on the
+// client's transport, and is ignored when WithHTTPClient or WithTransport is
+// used. Unlike the request timeout, they don't bound sending the request body,
+// so slow uploads aren't cut short.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.DialTimeout = timeout
+	}
+}
+
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.TLSHandshakeTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout bounds how long the upstream takes to send the
+// response headers, once the request is fully sent.
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.ResponseHeaderTimeout = timeout
+	}
+}
+
+// WithTLSConfig sets the TLS config of the client's transport. Like the
+// connection pool options, it is ignored when WithHTTPClient or WithTransport
+// is used.
+//
+// The config controls how upstream certificates are verified, so it must be
+// set with care.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *Options) {
+		o.TLSConfig = config.Clone()
+	}
+}
+
+// WithRootCAs sets the root CAs used to verify upstream certificates, instead
+// of the system ones.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(o *Options) {
+		o.tlsConfig().RootCAs = pool
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of upstream certificates,
+// which makes the connections open to man-in-the-middle attacks. It should
+// only be used for testing.
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(o *Options) {
+		o.tlsConfig().InsecureSkipVerify = skip
+	}
+}
+
+// WithDefaultHeaders sets headers added to every outgoing request, unless the
+// request already has them.
+func WithDefaultHeaders(headers http.Header) Option {
+	return func(o *Options) {
+		o.DefaultHeaders = headers.Clone()
+	}
+}
+
 func WithURLInterceptor(intcp interceptor.URLInterceptor) Option {
 	return func(o *Options) {
 		o.URLInterceptor = intcp
@@ -31,3 +223,129 @@ func WithRequestInterceptor(intcp interceptor.RequestInterceptor) Option {
 		o.RequestInterceptor = intcp
 	}
 }
+
+// WithRetryPolicy retries requests that failed to reach the upstream, or got
+// a retryable response, with an exponential backoff. Requests with a body
+// that can't be replayed are only sent once.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(o *Options) {
+		o.RetryPolicy = &policy
+	}
+}
+
+// WithCircuitBreakers fails requests fast while the breaker of their host is
+// open, instead of waiting for a failing upstream. The breakers' state changes
+// are reported by the group's OnStateChange.
+func WithCircuitBreakers(breakers *breaker.Group) Option {
+	return func(o *Options) {
+		o.Breakers = breakers
+	}
+}
+
+// WithMetricsCollector records the requests, including proxied ones, with the
+// collector, e.g. the Prometheus one of the metrics/prometheus module.
+func WithMetricsCollector(collector metrics.Collector) Option {
+	return func(o *Options) {
+		o.Metrics = collector
+	}
+}
+
+// WithTracer traces the requests, and the proxy calls around them, with the
+// tracer, e.g. the OpenTelemetry one of the tracing/otel module.
+func WithTracer(tracer tracing.Tracer) Option {
+	return func(o *Options) {
+		o.Tracer = tracer
+	}
+}
+
+// WithOAuth2 authorizes every request with a bearer token obtained with the
+// OAuth2 client credentials flow, and cached until it expires. A request
+// rejected with a 401 is sent again once with a new token. It overrides the
+// Authorization header of proxied requests.
+func WithOAuth2(clientID, clientSecret, tokenURL string, scopes ...string) Option {
+	return func(o *Options) {
+		o.OAuth2 = &clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			TokenURL:     tokenURL,
+			Scopes:       scopes,
+		}
+	}
+}
+
+// WithErrorOnNon2xx makes DoAPIRequest return non-2xx responses as *APIError,
+// with the response body closed. Proxied responses are still written as is.
+func WithErrorOnNon2xx() Option {
+	return func(o *Options) {
+		o.ErrorOnNon2xx = true
+	}
+}
+
+// WithRateLimit limits the requests with a path matching the pattern to rps
+// per second, with bursts of up to burst requests. The pattern is matched
+// with path.Match against the request URL path, and "*" matches every path,
+// e.g. for a global limit. A request waits for every limit it matches.
+//
+// A burst of 0 or less is 1. NewClient panics if rps is 0 or less, since no
+// request would ever be sent.
+//
+// Requests wait for their turn, unless it comes after their context deadline,
+// and fail with ErrRateLimited then.
+func WithRateLimit(pattern string, rps float64, burst int) Option {
+	return func(o *Options) {
+		limits := make([]RateLimit, len(o.RateLimits), len(o.RateLimits)+1)
+		copy(limits, o.RateLimits)
+
+		o.RateLimits = append(limits, RateLimit{Pattern: pattern, RPS: rps, Burst: burst})
+	}
+}
+
+// WithRateLimitFailFast makes the requests over the rate limits, or the
+// tracked quota, fail with ErrRateLimited right away, instead of waiting.
+func WithRateLimitFailFast() Option {
+	return func(o *Options) {
+		o.RateLimitFailFast = true
+	}
+}
+
+// WithQuotaTracking tracks the quota reported by the upstream responses in
+// the headers, see Client.Quota. Once it's used up, requests wait for the
+// reset like they do for WithRateLimit. The zero QuotaHeaders uses the
+// X-RateLimit-* headers.
+func WithQuotaTracking(headers QuotaHeaders) Option {
+	return func(o *Options) {
+		o.QuotaHeaders = &headers
+	}
+}
+
+// WithLoadBalancer spreads the requests to the base URL host, including
+// proxied ones, over the endpoints of the balancer. Only the scheme and host
+// of the base URL are replaced. The first endpoint is the base URL if none is
+// set. Retries go through the balancer again.
+func WithLoadBalancer(b *balancer.Balancer) Option {
+	return func(o *Options) {
+		o.LoadBalancer = b
+	}
+}
+
+// WithHealthCheck probes the path of every upstream, the base URL or the load
+// balancer endpoints, every interval in the background, see Client.Healthy.
+// An upstream is healthy if it responds with a 2xx within the interval, and
+// unhealthy endpoints are skipped by the load balancer. Client.Close or
+// Client.Shutdown stops the probes.
+func WithHealthCheck(path string, interval time.Duration) Option {
+	return func(o *Options) {
+		o.HealthCheckPath = path
+		o.HealthCheckInterval = interval
+	}
+}
+
+// WithMiddlewares adds middlewares around the requests, see Client.Use.
+func WithMiddlewares(middlewares ...Middleware) Option {
+	return func(o *Options) {
+		mws := make([]Middleware, len(o.Middlewares), len(o.Middlewares)+len(middlewares))
+		copy(mws, o.Middlewares)
+
+		o.Middlewares = append(mws, middlewares...)
+	}
+}
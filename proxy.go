@@ -1,20 +1,35 @@
 package api_client
 
 import (
+	"bufio"
 	"bytes"
-	"compress/gzip"
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"io"
-	"mime/multipart"
+	"io/ioutil"
 	"net/http"
-	"net/url"
-	"strconv"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/operaads/api-client/interceptor"
 	"github.com/operaads/api-client/proxy"
 	"github.com/operaads/api-client/request"
+	"github.com/operaads/api-client/response"
+	"github.com/operaads/api-client/retry"
+	"github.com/operaads/api-client/tracing"
 )
 
+// ProxyAPI proxies the incoming request to the path, and writes the upstream
+// response. The upstream request is made with the incoming request context,
+// so it carries its values and is cancelled with it, and context interceptors
+// are given it.
+//
+// Without an error handler, requests rejected before reaching the upstream,
+// e.g. with a body too large, get a plain response with the status of
+// proxy.ErrorStatus, and the other errors are left to the caller.
 func (c *Client) ProxyAPI(
 	method, path string,
 	httpReq *http.Request,
@@ -22,28 +37,308 @@ func (c *Client) ProxyAPI(
 	reqBodyType proxy.RequestBodyType,
 	opts ...proxy.Option,
 ) error {
-	if path == "" {
-		u := &url.URL{
-			Path:     httpReq.URL.Path,
-			RawQuery: httpReq.URL.RawQuery,
-			Fragment: httpReq.URL.Fragment,
+	_, err := c.ProxyAPIWithResult(method, path, httpReq, resWriter, reqBodyType, opts...)
+	return err
+}
+
+// ProxyAPIWithResult is like ProxyAPI, and also reports what was proxied.
+func (c *Client) ProxyAPIWithResult(
+	method, path string,
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	reqBodyType proxy.RequestBodyType,
+	opts ...proxy.Option,
+) (result proxy.Result, err error) {
+	opt := c.newProxyOptions(opts...)
+
+	var span tracing.Span
+	if c.Tracer != nil {
+		var ctx context.Context
+		ctx, span = c.Tracer.Start(httpReq.Context(), "proxy", tracing.SpanKindInternal)
+		span.SetAttribute("http.method", httpReq.Method)
+		span.SetAttribute("http.target", httpReq.URL.Path)
+
+		httpReq = httpReq.WithContext(tracing.ContextWithSpan(ctx, span))
+		defer func() {
+			endProxySpan(span, result, err)
+		}()
+	}
+
+	if opt.PreHandler != nil {
+		if canned, ok := opt.PreHandler(httpReq); ok {
+			opt.Notify(proxy.Event{
+				Type:    proxy.EventTypeShortCircuited,
+				Request: httpReq,
+			})
+
+			err = writeCannedResponse(httpReq, canned, resWriter, &result)
+			return result, err
 		}
-		path = u.String()
 	}
 
-	// if method is empty, set to http's request method
-	if method == "" {
-		method = httpReq.Method
+	if hasBody(httpReq) {
+		body := httpReq.Body
+		counter := &countingReader{ReadCloser: body}
+
+		httpReq.Body = counter
+		defer func() {
+			httpReq.Body = body
+			result.BytesRead = counter.n
+		}()
+	}
+
+	res, err := c.proxyAPIResponse(method, path, httpReq, reqBodyType, opt)
+	if err != nil {
+		writeProxyError(resWriter, httpReq, err, opt)
+		return result, err
+	}
+
+	start := time.Now()
+	if opt.DeferResponseWrite {
+		err = writeDeferredProxyResponse(httpReq, res, resWriter, opt, &result)
+	} else {
+		err = writeProxyResponse(httpReq, res, resWriter, opt, &result)
+
+		// nothing was written unless the body was being streamed
+		var streamErr *proxy.StreamError
+		if err != nil && opt.ErrorHandler != nil && !errors.As(err, &streamErr) {
+			opt.ErrorHandler(resWriter, httpReq, err)
+		}
 	}
+	if span != nil {
+		setDurationAttribute(span, "proxy.response_write_ms", start)
+	}
+
+	return result, err
+}
+
+// ProxyAPIResponse is like ProxyAPI, but returns the upstream response
+// instead of writing it. The caller must close the response body.
+// With proxy.WithErrorOnNon2xx, a non-2xx response is returned as *APIError.
+func (c *Client) ProxyAPIResponse(
+	method, path string,
+	httpReq *http.Request,
+	reqBodyType proxy.RequestBodyType,
+	opts ...proxy.Option,
+) (*http.Response, error) {
+	opt := c.newProxyOptions(opts...)
 
+	res, err := c.proxyAPIResponse(method, path, httpReq, reqBodyType, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.ErrorOnNon2xx {
+		if err := checkResponseStatus(res.Response); err != nil {
+			return nil, err
+		}
+	}
+
+	return res.Response, nil
+}
+
+// BuildProxyRequest builds the upstream request like ProxyAPI, without sending
+// it. The request body is buffered, so it can be read, and read again with
+// GetBody. The incoming request body is consumed. Rate limiters are not
+// waited for.
+func (c *Client) BuildProxyRequest(
+	method, path string,
+	httpReq *http.Request,
+	reqBodyType proxy.RequestBodyType,
+	opts ...proxy.Option,
+) (*http.Request, error) {
+	opt := c.newProxyOptions(opts...)
+	opt.RateLimiter = nil
+	opt.HostRateLimiters = nil
+
+	apiReq, done, err := c.newProxyAPIRequest(method, path, httpReq, reqBodyType, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	fullURL, err := c.apiRequestURL(apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := c.newHTTPRequest(apiReq.Context, fullURL, apiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasBody(req) {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		setRequestBody(req, bytes.NewReader(body))
+	}
+
+	return req, nil
+}
+
+func (c *Client) newProxyOptions(opts ...proxy.Option) *proxy.Options {
 	opt := &proxy.Options{
-		RequestTimeout: c.Timeout,
+		RequestTimeout: c.httpClient().Timeout,
 	}
 
 	for _, o := range opts {
 		o(opt)
 	}
 
+	return opt
+}
+
+func (c *Client) proxyAPIResponse(
+	method, path string,
+	httpReq *http.Request,
+	reqBodyType proxy.RequestBodyType,
+	opt *proxy.Options,
+) (res *response.APIResponse, err error) {
+	if opt.HealthProbePath != "" {
+		c.startHealthChecks(opt.HealthProbePath, opt.HealthProbeInterval)
+	}
+
+	if opt.TotalDeadline > 0 {
+		parentCtx := httpReq.Context()
+		ctx, cancel := context.WithTimeout(parentCtx, opt.TotalDeadline)
+		httpReq = httpReq.WithContext(ctx)
+
+		defer func() {
+			if err == nil {
+				res.Body = onClose(res.Body, cancel)
+				return
+			}
+
+			cancel()
+			if ctx.Err() == context.DeadlineExceeded && parentCtx.Err() == nil {
+				err = proxy.ErrTotalDeadlineExceeded
+			}
+		}()
+	}
+
+	apiReq, done, err := c.newProxyAPIRequest(method, path, httpReq, reqBodyType, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	method = apiReq.Method
+
+	send := func(apiReq *request.APIRequest) (*response.APIResponse, error) {
+		if opt.ConcurrencyLimiter == nil {
+			return c.doer().Do(apiReq)
+		}
+
+		if err := opt.ConcurrencyLimiter.Acquire(apiReq.Context, opt.ConcurrencyFailFast); err != nil {
+			return nil, err
+		}
+
+		res, err := c.doer().Do(apiReq)
+		if err != nil {
+			opt.ConcurrencyLimiter.Release()
+			return nil, err
+		}
+
+		res.Body = onClose(res.Body, opt.ConcurrencyLimiter.Release)
+
+		return res, nil
+	}
+	do := func() (*response.APIResponse, error) {
+		return send(apiReq)
+	}
+
+	if (method == http.MethodGet || method == http.MethodHead) && !isUpgradeRequest(httpReq) {
+		// keyed by the URL sent upstream, since interceptors and resolvers
+		// may route the same incoming path to different upstreams
+		upstreamURL, err := c.apiRequestURL(apiReq)
+		if err != nil {
+			return nil, err
+		}
+		key := credentialKey(method+" "+upstreamURL.String(), httpReq)
+
+		if opt.Singleflight {
+			flightKey := headerKey(key, httpReq, opt.SingleflightHeaders)
+			if opt.SingleflightKeyFunc != nil {
+				flightKey = opt.SingleflightKeyFunc(httpReq)
+			}
+
+			do = func() (*response.APIResponse, error) {
+				return c.doSingleflight(httpReq.Context(), flightKey, opt.SingleflightMaxBytes, func(ctx context.Context) (*response.APIResponse, error) {
+					flightReq := *apiReq
+					flightReq.Context = ctx
+					return send(&flightReq)
+				})
+			}
+		}
+
+		if opt.Cache != nil {
+			doRequest := do
+			storeKey := headerKey(key, httpReq, opt.CacheVary)
+
+			// not shared, the response is conditional
+			revalidate := func(etag string) (*response.APIResponse, error) {
+				hooks := make([]func(*http.Request) error, len(apiReq.SendHooks), len(apiReq.SendHooks)+1)
+				copy(hooks, apiReq.SendHooks)
+
+				condReq := *apiReq
+				condReq.SendHooks = append(hooks, func(req *http.Request) error {
+					req.Header.Set("If-None-Match", etag)
+					return nil
+				})
+
+				return send(&condReq)
+			}
+
+			do = func() (*response.APIResponse, error) {
+				return c.doCached(storeKey, method, opt, doRequest, revalidate)
+			}
+		}
+	}
+
+	if res, err = do(); err != nil {
+		return nil, upstreamError(httpReq, err, opt)
+	}
+
+	return res, nil
+}
+
+// newProxyAPIRequest builds the upstream request. done must be called once
+// the request is sent.
+func (c *Client) newProxyAPIRequest(
+	method, path string,
+	httpReq *http.Request,
+	reqBodyType proxy.RequestBodyType,
+	opt *proxy.Options,
+) (apiReq *request.APIRequest, done func(), err error) {
+	opt.SetContext(httpReq.Context())
+
+	path, err = proxyPath(path, httpReq, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opt.UpstreamResolver != nil {
+		base, err := opt.UpstreamResolver(httpReq)
+		if err != nil {
+			return nil, nil, err
+		}
+		if path, err = upstreamURL(base, path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// if method is empty, set to http's request method
+	if method == "" {
+		method = httpReq.Method
+	}
+	if method, err = normalizeMethod(method, opt); err != nil {
+		return nil, nil, err
+	}
+
 	var reqParseFunc func(*http.Request, *proxy.Options) (io.Reader, string, error)
 
 	switch reqBodyType {
@@ -59,142 +354,226 @@ func (c *Client) ProxyAPI(
 		}
 	}
 
+	var cleanups []func()
+	cleanup := func() {
+		for _, fn := range cleanups {
+			fn()
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	start := time.Now()
+
+	var reqDecompressed bool
+	if opt.DecompressRequest {
+		body := httpReq.Body
+		if reqDecompressed, err = decompressRequestBody(httpReq, opt); err != nil {
+			return nil, nil, err
+		}
+		cleanups = append(cleanups, func() {
+			httpReq.Body = body
+		})
+	}
+
 	reqBody, reqContentType, err := reqParseFunc(httpReq, opt)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	if span := tracing.SpanFromContext(httpReq.Context()); span != nil {
+		setDurationAttribute(span, "proxy.request_intercept_ms", start)
+	}
+
+	reqPassthrough := reqBody == io.Reader(httpReq.Body)
+
+	if opt.RetryPolicy != nil || opt.HedgePolicy != nil {
+		maxBuffer := int64(retry.DefaultMaxBufferBytes)
+		if opt.RetryPolicy != nil {
+			maxBuffer = opt.RetryPolicy.BufferBytes()
+		}
+
+		if reqBody, err = replayableBody(reqBody, maxBuffer); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the transport closes it once sent, but the request may fail before
+	if spilled, ok := reqBody.(*spillBuffer); ok {
+		cleanups = append(cleanups, func() {
+			spilled.Close()
+		})
+	}
+	// stops the goroutine writing a streamed body
+	if pr, ok := reqBody.(*io.PipeReader); ok {
+		cleanups = append(cleanups, func() {
+			pr.Close()
+		})
+	}
+
+	var authorization string
+	if opt.AuthProvider != nil {
+		if authorization, err = opt.AuthProvider(httpReq.Context()); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	requestOptions := []request.Option{
 		request.WithRequestInterceptors(func(r *http.Request) {
-			for k, vv := range httpReq.Header {
-				for _, v := range vv {
-					r.Header.Add(k, v)
+			forwardRequestHeaders(r.Header, httpReq.Header, opt)
+			if opt.ForwardedHeaders {
+				setForwardedHeaders(r.Header, httpReq, opt)
+			}
+			addDefaultHeaders(r.Header, opt)
+			if opt.UserAgent != "" {
+				r.Header.Set("User-Agent", opt.UserAgent)
+			}
+			if len(opt.UpstreamAcceptEncoding) > 0 {
+				r.Header.Set("Accept-Encoding", strings.Join(opt.UpstreamAcceptEncoding, ", "))
+			}
+			if policy := opt.RequestHeaderPolicy; policy != nil {
+				for k, vv := range policy.Set {
+					r.Header[k] = append([]string(nil), vv...)
 				}
+				if policy.PreserveHost {
+					r.Host = httpReq.Host
+				}
+			}
+			if reqDecompressed {
+				r.Header.Del("Content-Encoding")
+			} else if reqPassthrough && httpReq.ContentLength > 0 {
+				// a body of unknown length is sent chunked, which some
+				// upstreams reject for methods like DELETE
+				r.ContentLength = httpReq.ContentLength
 			}
 
 			if reqContentType != "" {
 				r.Header.Set("Content-Type", reqContentType)
 			}
+			if opt.AuthProvider != nil {
+				r.Header.Set("Authorization", authorization)
+			}
 		}),
 		request.WithRequestTimeout(opt.RequestTimeout),
+		// the upstream request is cancelled along with the incoming request
+		request.WithContext(httpReq.Context()),
+		request.WithRetryPolicy(opt.RetryPolicy),
+		request.WithHedging(opt.HedgePolicy),
+		request.WithPathTemplate(opt.PathTemplate),
+		request.WithSigner(opt.RequestSigner),
+		request.WithRequestBodyEncoding(opt.RequestBodyEncoding),
 	}
 
-	if opt.URLInterceptor != nil {
+	if opt.RateLimiter != nil || opt.HostRateLimiters != nil {
 		requestOptions = append(
 			requestOptions,
-			request.AppendURLInterceptors(opt.URLInterceptor),
+			request.AppendSendHooks(func(r *http.Request) error {
+				limiter, ok := opt.HostRateLimiters[r.URL.Host]
+				if !ok {
+					limiter = opt.RateLimiter
+				}
+				if limiter == nil {
+					return nil
+				}
+
+				return limiter.Wait(r.Context())
+			}),
 		)
 	}
-	if opt.RequestInterceptor != nil {
+
+	if opt.RoundTripper != nil {
 		requestOptions = append(
 			requestOptions,
-			request.AppendRequestInterceptors(opt.RequestInterceptor),
+			request.AppendTransports(func(http.RoundTripper) http.RoundTripper {
+				return opt.RoundTripper
+			}),
 		)
 	}
 
-	apiReq := request.NewAPIRequest(
-		method, path, reqBody,
-		requestOptions...,
-	)
-
-	res, err := c.DoAPIRequest(apiReq)
-	if err != nil {
-		return err
+	if opt.Trace {
+		requestOptions = append(
+			requestOptions,
+			request.AppendTransports(func(base http.RoundTripper) http.RoundTripper {
+				return &traceTransport{base: base, opt: opt, httpReq: httpReq}
+			}),
+		)
 	}
 
-	if res.StatusCode == http.StatusNoContent {
-		resWriter.WriteHeader(http.StatusNoContent)
-
-		// transfer response headers
-		for _, h := range opt.TransferResponseHeaders {
-			if vv, ok := res.Header[h]; ok {
-				headerValue := make([]string, len(vv))
-				copy(headerValue, vv)
-
-				resWriter.Header()[h] = headerValue
-			}
-		}
-
-		return nil
+	if len(opt.HostPolicies) > 0 {
+		requestOptions = append(
+			requestOptions,
+			request.AppendTransports(func(base http.RoundTripper) http.RoundTripper {
+				return &hostPolicyTransport{
+					base:     base,
+					policies: opt.HostPolicies,
+					opt:      opt,
+					httpReq:  httpReq,
+				}
+			}),
+		)
 	}
 
-	defer res.Body.Close()
-
-	resHeaders := make(http.Header)
-
-	// transfer response headers
-	for _, h := range opt.TransferResponseHeaders {
-		if vv, ok := res.Header[h]; ok {
-			headerValue := make([]string, len(vv))
-			copy(headerValue, vv)
-			resHeaders[h] = headerValue
-		}
+	if !opt.FollowRedirects {
+		requestOptions = append(
+			requestOptions,
+			request.WithCheckRedirect(func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}),
+		)
 	}
 
-	var resBody io.Reader
-
-	resContentEncoding := res.Header.Get("Content-Encoding")
-
-	if opt.ResponseJSONInterceptor != nil {
-		var obj interface{}
-
-		var reader io.Reader
-		switch resContentEncoding {
-		case "gzip":
-			if gzReader, err := gzip.NewReader(res.Body); err != nil {
-				return err
-			} else {
-				reader = gzReader
-			}
-		default:
-			reader = res.Body
-		}
-
-		if err := json.NewDecoder(reader).Decode(&obj); err != nil {
-			return err
-		}
-
-		if newObj, err := opt.ResponseJSONInterceptor(obj); err != nil {
-			return err
-		} else {
-			obj = newObj
-		}
-
-		buf := new(bytes.Buffer)
-		if err := json.NewEncoder(buf).Encode(obj); err != nil {
-			return err
-		}
-
-		resHeaders.Set("Content-Type", "application/json; charset=utf-8")
-		resHeaders.Set("Content-Length", strconv.Itoa(buf.Len()))
+	if opt.URLInterceptor != nil {
+		requestOptions = append(requestOptions, request.AppendURLInterceptors(opt.URLInterceptor))
+	}
+	if opt.RequestInterceptor != nil {
+		requestOptions = append(requestOptions, request.AppendRequestInterceptors(opt.RequestInterceptor))
+	}
+	requestOptions = append(
+		requestOptions,
+		request.AppendURLInterceptors(opt.URLInterceptors...),
+		request.AppendRequestInterceptors(opt.RequestInterceptors...),
+	)
 
-		resBody = buf
-	} else {
-		resHeaders.Set("Content-Type", res.Header.Get("Content-Type"))
+	if opt.RequestRewriter != nil {
+		requestOptions = append(
+			requestOptions,
+			request.AppendSendHooks(func(r *http.Request) error {
+				body, err := opt.RequestRewriter(r)
+				if err != nil || body == nil {
+					return err
+				}
 
-		if res.ContentLength >= 0 {
-			resHeaders.Set("Content-Length", strconv.FormatInt(res.ContentLength, 10))
-		}
-		if resContentEncoding != "" {
-			resHeaders.Set("Content-Encoding", resContentEncoding)
-		}
+				setRequestBody(r, body)
 
-		resBody = res.Body
+				return nil
+			}),
+		)
 	}
 
-	for k, vv := range resHeaders {
-		resWriter.Header()[k] = vv
-	}
+	apiReq = request.NewAPIRequest(
+		method, path, reqBody,
+		requestOptions...,
+	)
 
-	// write status code
-	resWriter.WriteHeader(res.StatusCode)
+	return apiReq, cleanup, nil
+}
 
-	// copy response
-	if _, err := io.Copy(resWriter, resBody); err != nil {
-		return err
-	}
+// ProxyXMLAPI proxies an XML API, forwarding the request body as is unless
+// an XML request interceptor is set.
+func (c *Client) ProxyXMLAPI(
+	method, path string,
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	opts ...proxy.Option,
+) error {
+	return c.ProxyAPI(method, path, httpReq, resWriter, proxy.RequestBodyTypeRaw, opts...)
+}
 
-	return nil
+func (c *Client) TransparentProxyXMLAPI(httpReq *http.Request, resWriter http.ResponseWriter) error {
+	return c.ProxyXMLAPI("", "", httpReq, resWriter)
 }
 
 func (c *Client) TransparentProxyAPI(httpReq *http.Request, resWriter http.ResponseWriter, requestType proxy.RequestBodyType) error {
@@ -214,107 +593,94 @@ func (c *Client) TransparentProxyGetAPI(httpReq *http.Request, resWriter http.Re
 	return c.ProxyGetAPI("", httpReq, resWriter)
 }
 
-func parseRawRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
-	if opt.RequestJSONInterceptor != nil {
-		defer req.Body.Close()
-
-		var obj interface{}
+func transformJSON(
+	r io.Reader,
+	intcp interceptor.JSONInterceptor,
+	keyCase proxy.CaseDirection,
+	opt *proxy.Options,
+) (*bytes.Buffer, error) {
+	var obj interface{}
+
+	decoder := json.NewDecoder(r)
+	if opt.JSONUseNumber {
+		decoder.UseNumber()
+	}
 
-		if err := json.NewDecoder(req.Body).Decode(&obj); err != nil {
-			return nil, "", err
+	if opt.OrderedJSON {
+		var err error
+		if obj, err = proxy.DecodeOrderedJSON(decoder); err != nil {
+			return nil, err
 		}
+	} else if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
 
-		if newObj, err := opt.RequestJSONInterceptor(obj); err != nil {
-			return nil, "", err
+	if intcp != nil {
+		if newObj, err := intcp(obj); err != nil {
+			return nil, err
 		} else {
 			obj = newObj
 		}
-
-		buf := new(bytes.Buffer)
-		if err := json.NewEncoder(buf).Encode(obj); err != nil {
-			return nil, "", err
-		}
-
-		return buf, "application/json; charset=utf-8", nil
 	}
 
-	contentType := req.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
+	obj = proxy.ConvertKeys(obj, keyCase)
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(obj); err != nil {
+		return nil, err
 	}
 
-	return req.Body, contentType, nil
+	return buf, nil
 }
 
-func parseFormRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
-	if err := req.ParseForm(); err != nil {
-		return nil, "", err
-	}
-
-	form := url.Values{}
-	for k, vv := range req.PostForm {
-		for _, v := range vv {
-			form.Add(k, v)
-		}
-	}
+func interceptXML(r io.Reader, w io.Writer, intcp interceptor.XMLInterceptor) error {
+	encoder := xml.NewEncoder(w)
 
-	if opt.RequestFormInterceptor != nil {
-		if newForm, err := opt.RequestFormInterceptor(form); err != nil {
-			return nil, "", err
-		} else {
-			form = newForm
+	// the declaration is kept, the interceptor never sees it
+	br := bufio.NewReader(r)
+	if decl := readXMLDeclaration(br); decl != nil {
+		if err := encoder.EncodeToken(*decl); err != nil {
+			return err
 		}
 	}
 
-	contentType := req.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/x-www-form-urlencoded"
+	if err := intcp(xml.NewDecoder(br), encoder); err != nil {
+		return err
 	}
 
-	return strings.NewReader(form.Encode()), contentType, nil
+	return encoder.Flush()
 }
 
-func parseMultipartFormRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
-	if err := req.ParseMultipartForm(opt.MaxUploadSize); err != nil {
-		return nil, "", err
-	}
-
-	reqBody := new(bytes.Buffer)
-	multiWriter := multipart.NewWriter(reqBody)
+var xmlDeclarationEncoding = regexp.MustCompile(`encoding\s*=\s*["']([^"']*)["']`)
 
-	defer multiWriter.Close()
-
-	for k, vv := range req.MultipartForm.Value {
-		for _, v := range vv {
-			if err := multiWriter.WriteField(k, v); err != nil {
-				return nil, "", err
-			}
-		}
+// readXMLDeclaration consumes the UTF-8 XML declaration at the start of br,
+// if any. Declarations of other encodings are left to the decoder, which
+// rejects them.
+func readXMLDeclaration(br *bufio.Reader) *xml.ProcInst {
+	start, _ := br.Peek(6)
+	if len(start) < 6 || string(start[:5]) != "<?xml" || !strings.ContainsRune(" \t\r\n", rune(start[5])) {
+		return nil
 	}
 
-	for k, vv := range req.MultipartForm.File {
-		for _, v := range vv {
-			f, err := v.Open()
-			if err != nil {
-				return nil, "", err
-			}
-			writer, err := multiWriter.CreateFormFile(k, v.Filename)
-			if err != nil {
-				return nil, "", err
-			}
-			if _, err := io.Copy(writer, f); err != nil {
-				return nil, "", err
-			}
-
-			f.Close()
+	var b []byte
+	end := -1
+	for n := 64; end < 0; n *= 2 {
+		var err error
+		b, err = br.Peek(n)
+		if end = bytes.Index(b, []byte("?>")); end < 0 && err != nil {
+			// the document or the buffer ended first, the decoder reports it
+			return nil
 		}
 	}
 
-	if opt.RequestMultipartFormInterceptor != nil {
-		if err := opt.RequestMultipartFormInterceptor(multiWriter); err != nil {
-			return nil, "", err
-		}
+	inst := b[len("<?xml"):end]
+	if m := xmlDeclarationEncoding.FindSubmatch(inst); m != nil && !strings.EqualFold(string(m[1]), "utf-8") {
+		return nil
 	}
 
-	return reqBody, multiWriter.FormDataContentType(), nil
+	decl := &xml.ProcInst{Target: "xml", Inst: append([]byte(nil), bytes.TrimSpace(inst)...)}
+	// can't fail, the bytes are buffered
+	br.Discard(end + len("?>"))
+
+	return decl
 }
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// CachedResponse is an upstream response stored in a CacheStore. Body is
+// decompressed. Once Expires is past, the response is stale, and is
+// revalidated with the upstream if it has an ETag. A zero Expires never goes
+// stale.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Expires    time.Time
+}
+
+// Fresh reports whether the response can be served without revalidation.
+func (r *CachedResponse) Fresh(now time.Time) bool {
+	return r.Expires.IsZero() || now.Before(r.Expires)
+}
+
+// CacheStore stores the cached responses, for at least their ttl. The cache
+// package has an in-memory store, and the cache/redis module a Redis one.
+type CacheStore interface {
+	Get(key string) (*CachedResponse, bool)
+	Set(key string, res *CachedResponse, ttl time.Duration)
+}
+
+// Cache is the former name of CacheStore.
+type Cache = CacheStore
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"context"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ConcurrencyLimiter limits the number of in-flight upstream requests. It's
+// meant to be shared by all the proxy calls it limits.
+type ConcurrencyLimiter struct {
+	sem      *semaphore.Weighted
+	inFlight int64
+}
+
+func NewConcurrencyLimiter(n int64) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{sem: semaphore.NewWeighted(n)}
+}
+
+// Acquire waits for a slot until ctx is done, or fails immediately with
+// ErrConcurrencyLimitExceeded if failFast is true.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, failFast bool) error {
+	if failFast {
+		if !l.sem.TryAcquire(1) {
+			return ErrConcurrencyLimitExceeded
+		}
+	} else if err := l.sem.Acquire(ctx, 1); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&l.inFlight, 1)
+
+	return nil
+}
+
+func (l *ConcurrencyLimiter) Release() {
+	atomic.AddInt64(&l.inFlight, -1)
+	l.sem.Release(1)
+}
+
+func (l *ConcurrencyLimiter) InFlight() int64 {
+	return atomic.LoadInt64(&l.inFlight)
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorHandler writes the response of a request that couldn't be proxied.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// ErrorResponse is the JSON body written by JSONErrorHandler.
+type ErrorResponse struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// JSONErrorHandler writes an ErrorResponse with the status of ErrorStatus,
+// and the Retry-After of an ExhaustedError.
+func JSONErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := ErrorStatus(err)
+
+	var exhaustedErr *ExhaustedError
+	if errors.As(err, &exhaustedErr) && exhaustedErr.RetryAfter > 0 {
+		retryAfter := int64((exhaustedErr.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+
+	body, _ := json.Marshal(ErrorResponse{Status: status, Error: http.StatusText(status)})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// ErrorStatus returns the status code of a response to a request that failed
+// with err: 429 when rate limited, the exhaustion status of an ExhaustedError
+// if set, 504 for timeouts, 503 when the concurrency limit is exceeded,
+// 413 for request bodies too large, 404 when the path doesn't match the
+// stripped prefix, 400 for invalid methods and GraphQL requests, and 502
+// otherwise.
+func ErrorStatus(err error) int {
+	var exhaustedErr *ExhaustedError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.As(err, &exhaustedErr) && exhaustedErr.Status != 0:
+		return exhaustedErr.Status
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return http.StatusGatewayTimeout
+	case errors.Is(err, ErrConcurrencyLimitExceeded):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrRequestTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrPathNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidMethod),
+		errors.Is(err, ErrInvalidGraphQLRequest):
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorStatus(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+	}{
+		{errors.New("connection refused"), http.StatusBadGateway},
+		{ErrTotalDeadlineExceeded, http.StatusGatewayTimeout},
+		{fmt.Errorf("wrapped: %w", ErrRateLimited), http.StatusTooManyRequests},
+		{ErrConcurrencyLimitExceeded, http.StatusServiceUnavailable},
+		{ErrRequestTooLarge, http.StatusRequestEntityTooLarge},
+		{ErrPathNotFound, http.StatusNotFound},
+		{ErrInvalidMethod, http.StatusBadRequest},
+		{ErrInvalidGraphQLRequest, http.StatusBadRequest},
+		{&ExhaustedError{Attempts: []Attempt{{Err: errors.New("refused")}}}, http.StatusBadGateway},
+		{&ExhaustedError{Attempts: []Attempt{{Err: ErrTotalDeadlineExceeded}}}, http.StatusGatewayTimeout},
+		{&ExhaustedError{Attempts: []Attempt{{Err: ErrTotalDeadlineExceeded}}, Status: http.StatusServiceUnavailable}, http.StatusServiceUnavailable},
+		{&ExhaustedError{Attempts: []Attempt{{Err: ErrRateLimited}}, Status: http.StatusServiceUnavailable}, http.StatusTooManyRequests},
+	} {
+		if got := ErrorStatus(tc.err); got != tc.status {
+			t.Errorf("ErrorStatus(%v) = %d, want %d", tc.err, got, tc.status)
+		}
+	}
+}
+
+func TestJSONErrorHandler(t *testing.T) {
+	err := &ExhaustedError{
+		Attempts:   []Attempt{{Upstream: "http://upstream", Err: errors.New("refused")}},
+		Status:     http.StatusServiceUnavailable,
+		RetryAfter: 1500 * time.Millisecond,
+	}
+
+	rec := httptest.NewRecorder()
+	JSONErrorHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil), err)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got, want := rec.Body.String(), `{"status":503,"error":"Service Unavailable"}`+"\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
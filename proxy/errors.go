@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrResponseTooLarge        = errors.New("proxy: response body too large")
+	ErrRequestTooLarge         = errors.New("proxy: request body too large")
+	ErrResponseHeadersTooLarge = errors.New("proxy: response headers too large")
+	ErrPathNotFound            = errors.New("proxy: path does not match the stripped prefix")
+	ErrInvalidMethod           = errors.New("proxy: invalid method")
+
+	ErrConcurrencyLimitExceeded = errors.New("proxy: concurrency limit exceeded")
+
+	// ErrRateLimited is returned when a request can't be sent under the client
+	// rate limits.
+	ErrRateLimited = errors.New("proxy: rate limited")
+
+	// ErrTotalDeadlineExceeded wraps context.DeadlineExceeded.
+	ErrTotalDeadlineExceeded = fmt.Errorf("proxy: total deadline exceeded: %w", context.DeadlineExceeded)
+
+	ErrInvalidGraphQLRequest = errors.New("proxy: invalid GraphQL request")
+
+	ErrNotUpgradeRequest   = errors.New("proxy: not a protocol upgrade request")
+	ErrHijackNotSupported  = errors.New("proxy: response writer does not support hijacking")
+	ErrUpgradeNotSupported = errors.New("proxy: upstream connection is not writable after upgrade")
+
+	ErrWebSocketSubprotocol = errors.New("proxy: upstream selected a WebSocket subprotocol that wasn't offered")
+
+	// ErrSkipRow can be returned by a CSV interceptor to drop the row.
+	ErrSkipRow = errors.New("proxy: skip row")
+)
+
+type Attempt struct {
+	Upstream string
+	Err      error
+}
+
+// ExhaustedError is returned when every attempt to reach an upstream failed.
+type ExhaustedError struct {
+	Attempts []Attempt
+
+	// Status and RetryAfter are those of WithExhaustionResponse, if set.
+	Status     int
+	RetryAfter time.Duration
+}
+
+func (e *ExhaustedError) Error() string {
+	msgs := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		msgs[i] = a.Upstream + ": " + a.Err.Error()
+	}
+
+	return "all upstreams failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	if len(e.Attempts) == 0 {
+		return nil
+	}
+
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// MultipartPartError is returned when a part of a multipart request body
+// couldn't be copied upstream.
+type MultipartPartError struct {
+	FormName string
+	FileName string
+	Err      error
+}
+
+func (e *MultipartPartError) Error() string {
+	if e.FileName != "" {
+		return "proxy: multipart file " + strconv.Quote(e.FileName) + " of " + strconv.Quote(e.FormName) + ": " + e.Err.Error()
+	}
+
+	return "proxy: multipart field " + strconv.Quote(e.FormName) + ": " + e.Err.Error()
+}
+
+func (e *MultipartPartError) Unwrap() error {
+	return e.Err
+}
+
+// StreamError is returned when copying the response body failed after the
+// status code was written. The client got a truncated body, so the handler
+// should abort the connection, e.g. by panicking with http.ErrAbortHandler,
+// rather than end the response normally.
+type StreamError struct {
+	// BytesWritten is the number of body bytes written before the failure.
+	BytesWritten int64
+	Err          error
+}
+
+func (e *StreamError) Error() string {
+	return "proxy: response stream failed after " + strconv.FormatInt(e.BytesWritten, 10) + " bytes: " + e.Err.Error()
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/operaads/api-client/breaker"
+)
+
+type EventType string
+
+const (
+	EventTypeUpstreamsExhausted = EventType("UPSTREAMS_EXHAUSTED")
+	EventTypeBreakerStateChange = EventType("BREAKER_STATE_CHANGE")
+	EventTypeShortCircuited     = EventType("SHORT_CIRCUITED")
+	EventTypeStreamError        = EventType("STREAM_ERROR")
+	EventTypeTimings            = EventType("TIMINGS")
+	EventTypeErrorBodyReplaced  = EventType("ERROR_BODY_REPLACED")
+
+	EventTypeResponseHeadersTooLarge = EventType("RESPONSE_HEADERS_TOO_LARGE")
+)
+
+type Event struct {
+	Type    EventType
+	Request *http.Request
+	Err     error
+
+	// Upstream is the upstream host the event relates to, if any.
+	Upstream string
+
+	// BreakerState is the new state for EventTypeBreakerStateChange.
+	BreakerState breaker.State
+
+	// Timings is the breakdown of an attempt for EventTypeTimings.
+	Timings Timings
+}
+
+type Observer func(Event)
+
+func (o *Options) Notify(e Event) {
+	if o.Observer != nil {
+		o.Observer(e)
+	}
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import "strings"
+
+type GraphQLOperationType string
+
+const (
+	GraphQLOperationTypeQuery        = GraphQLOperationType("query")
+	GraphQLOperationTypeMutation     = GraphQLOperationType("mutation")
+	GraphQLOperationTypeSubscription = GraphQLOperationType("subscription")
+)
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// IsPersistedQuery reports whether the request only sends the hash of a
+// persisted query.
+func (r *GraphQLRequest) IsPersistedQuery() bool {
+	if r.Query != "" {
+		return false
+	}
+
+	_, ok := r.Extensions["persistedQuery"]
+	return ok
+}
+
+// OperationType returns the type of the operation executed by the request,
+// or an empty string if it can't be told, e.g. for a persisted query.
+func (r *GraphQLRequest) OperationType() GraphQLOperationType {
+	tokens := graphQLTokens(r.Query)
+	depth := 0
+	// whether a top level definition is started with a keyword
+	inDefinition := false
+
+	for i, tok := range tokens {
+		switch tok {
+		case "{":
+			// shorthand query
+			if depth == 0 && !inDefinition && r.OperationName == "" {
+				return GraphQLOperationTypeQuery
+			}
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				inDefinition = false
+			}
+		default:
+			if depth != 0 || inDefinition {
+				continue
+			}
+			inDefinition = true
+
+			if !isGraphQLOperation(tok) {
+				continue
+			}
+
+			typ := GraphQLOperationType(tok)
+			if r.OperationName == "" {
+				return typ
+			}
+			if i+1 < len(tokens) && tokens[i+1] == r.OperationName {
+				return typ
+			}
+		}
+	}
+
+	return ""
+}
+
+func isGraphQLOperation(tok string) bool {
+	switch GraphQLOperationType(tok) {
+	case GraphQLOperationTypeQuery, GraphQLOperationTypeMutation, GraphQLOperationTypeSubscription:
+		return true
+	default:
+		return false
+	}
+}
+
+// graphQLTokens splits the document into names and braces, skipping
+// comments, strings and any other punctuation.
+func graphQLTokens(doc string) []string {
+	var tokens []string
+
+	for i := 0; i < len(doc); i++ {
+		c := doc[i]
+
+		switch {
+		case c == '#':
+			for i < len(doc) && doc[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(doc[i:], `"""`):
+			end := strings.Index(doc[i+3:], `"""`)
+			if end < 0 {
+				return tokens
+			}
+			i += 3 + end + 2
+		case c == '"':
+			for i++; i < len(doc) && doc[i] != '"'; i++ {
+				if doc[i] == '\\' {
+					i++
+				}
+			}
+		case c == '{' || c == '}':
+			tokens = append(tokens, string(c))
+		case isGraphQLNameStart(c):
+			start := i
+			for i+1 < len(doc) && (isGraphQLNameStart(doc[i+1]) || doc[i+1] >= '0' && doc[i+1] <= '9') {
+				i++
+			}
+			tokens = append(tokens, doc[start:i+1])
+		}
+	}
+
+	return tokens
+}
+
+func isGraphQLNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
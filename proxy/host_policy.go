@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/operaads/api-client/breaker"
+)
+
+// HostPolicy configures requests to an upstream host.
+type HostPolicy struct {
+	// Timeout bounds each attempt, within the request timeout.
+	Timeout time.Duration
+
+	// Retries is the number of retries after a failed attempt that could not
+	// reach the upstream, or got a 429 or 503 response. Requests with a body
+	// that can't be replayed aren't retried, nor are requests with methods
+	// like POST unless RetryNonIdempotent is set.
+	Retries int
+
+	// RetryNonIdempotent allows retrying requests with methods like POST,
+	// which the upstream may have already processed.
+	RetryNonIdempotent bool
+
+	// RetryBackoff and RetryMaxBackoff bound the exponential backoff, with
+	// jitter, between attempts. They default to 100ms and 10s. A longer
+	// Retry-After sent by the upstream is honored, unless it exceeds the
+	// request deadline.
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+
+	// Breaker, if set, fails requests fast while it's open. It's meant to be
+	// shared by all the proxy calls to the host.
+	Breaker *breaker.CircuitBreaker
+}
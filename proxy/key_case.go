@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"strings"
+	"unicode"
+)
+
+type CaseDirection string
+
+const (
+	CaseDirectionNone         = CaseDirection("")
+	CaseDirectionCamelToSnake = CaseDirection("CAMEL_TO_SNAKE")
+	CaseDirectionSnakeToCamel = CaseDirection("SNAKE_TO_CAMEL")
+)
+
+func (d CaseDirection) Reverse() CaseDirection {
+	switch d {
+	case CaseDirectionCamelToSnake:
+		return CaseDirectionSnakeToCamel
+	case CaseDirectionSnakeToCamel:
+		return CaseDirectionCamelToSnake
+	default:
+		return CaseDirectionNone
+	}
+}
+
+// ConvertKeys recursively converts the keys of all JSON objects in obj,
+// including objects nested in arrays.
+func ConvertKeys(obj interface{}, direction CaseDirection) interface{} {
+	var convert func(string) string
+
+	switch direction {
+	case CaseDirectionCamelToSnake:
+		convert = CamelToSnake
+	case CaseDirectionSnakeToCamel:
+		convert = SnakeToCamel
+	default:
+		return obj
+	}
+
+	return convertKeys(obj, convert)
+}
+
+func convertKeys(obj interface{}, convert func(string) string) interface{} {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, vv := range v {
+			m[convert(k)] = convertKeys(vv, convert)
+		}
+		return m
+	case OrderedMap:
+		m := make(OrderedMap, len(v))
+		for i, kv := range v {
+			m[i] = KeyValue{Key: convert(kv.Key), Value: convertKeys(kv.Value, convert)}
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, vv := range v {
+			arr[i] = convertKeys(vv, convert)
+		}
+		return arr
+	default:
+		return obj
+	}
+}
+
+func CamelToSnake(s string) string {
+	var b strings.Builder
+
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' &&
+				(unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+					(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func SnakeToCamel(s string) string {
+	var b strings.Builder
+
+	upper := false
+	for i, r := range s {
+		if r == '_' && i > 0 {
+			upper = true
+			continue
+		}
+
+		if upper {
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	if upper {
+		b.WriteByte('_')
+	}
+
+	return b.String()
+}
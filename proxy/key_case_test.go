@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCamelToSnake(t *testing.T) {
+	for in, want := range map[string]string{
+		"userId":      "user_id",
+		"HTTPServer":  "http_server",
+		"userID":      "user_id",
+		"address2Zip": "address2_zip",
+		"already_ok":  "already_ok",
+		"":            "",
+	} {
+		if got := CamelToSnake(in); got != want {
+			t.Errorf("CamelToSnake(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSnakeToCamel(t *testing.T) {
+	for in, want := range map[string]string{
+		"user_id":     "userId",
+		"http_server": "httpServer",
+		"_private":    "_private",
+		"trailing_":   "trailing_",
+		"alreadyOk":   "alreadyOk",
+	} {
+		if got := SnakeToCamel(in); got != want {
+			t.Errorf("SnakeToCamel(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestConvertKeys(t *testing.T) {
+	camel := map[string]interface{}{
+		"userId": 1.0,
+		"homeAddress": map[string]interface{}{
+			"zipCode": "1000",
+		},
+		"orderItems": []interface{}{
+			map[string]interface{}{"itemId": 2.0},
+			"notAKey",
+		},
+	}
+	snake := map[string]interface{}{
+		"user_id": 1.0,
+		"home_address": map[string]interface{}{
+			"zip_code": "1000",
+		},
+		"order_items": []interface{}{
+			map[string]interface{}{"item_id": 2.0},
+			"notAKey",
+		},
+	}
+
+	if got := ConvertKeys(camel, CaseDirectionCamelToSnake); !reflect.DeepEqual(got, snake) {
+		t.Errorf("camel to snake = %v, want %v", got, snake)
+	}
+	if got := ConvertKeys(snake, CaseDirectionSnakeToCamel); !reflect.DeepEqual(got, camel) {
+		t.Errorf("snake to camel = %v, want %v", got, camel)
+	}
+	if got := ConvertKeys(camel, CaseDirectionNone); !reflect.DeepEqual(got, camel) {
+		t.Errorf("none = %v, want %v", got, camel)
+	}
+
+	ordered := OrderedMap{{Key: "userId", Value: OrderedMap{{Key: "zipCode", Value: "1"}}}}
+	want := OrderedMap{{Key: "user_id", Value: OrderedMap{{Key: "zip_code", Value: "1"}}}}
+	if got := ConvertKeys(ordered, CaseDirectionCamelToSnake); !reflect.DeepEqual(got, want) {
+		t.Errorf("ordered camel to snake = %v, want %v", got, want)
+	}
+}
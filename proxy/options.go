@@ -1,49 +1,676 @@
 package proxy
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
 	"time"
 
 	"github.com/operaads/api-client/interceptor"
+	"github.com/operaads/api-client/request"
+	"github.com/operaads/api-client/retry"
+	"golang.org/x/time/rate"
 )
 
 type Options struct {
-	MaxUploadSize  int64
-	RequestTimeout time.Duration
+	MaxUploadSize      int64
+	RequestTimeout     time.Duration
+	TotalDeadline      time.Duration
+	FollowRedirects    bool
+	AllowCustomMethods bool
+	DecompressRequest  bool
 
+	MultipartStorageDir string
+	MultipartInMemory   bool
+
+	StripPathPrefix string
+	PathPrefix      string
+	PathRewrites    []PathRewrite
+	CopyBufferSize  int
+
+	MaxResponseBytes int64
+
+	CompressResponse    bool
+	RecompressResponse  bool
+	CompressMinSize     int64
+	HonorAcceptEncoding bool
+
+	UpstreamAcceptEncoding []string
+
+	Cache              CacheStore
+	CacheTTL           time.Duration
+	CacheVary          []string
+	CacheMaxObjectSize int64
+
+	Singleflight         bool
+	SingleflightKeyFunc  func(*http.Request) string
+	SingleflightHeaders  []string
+	SingleflightMaxBytes int64
+
+	UpstreamResolver    UpstreamResolver
+	URLInterceptors     []interceptor.URLInterceptor
+	QueryInterceptors   []interceptor.QueryInterceptor
+	RequestInterceptors []interceptor.RequestInterceptor
+	RequestRewriter     interceptor.RequestRewriter
+
+	// Deprecated: use URLInterceptors and RequestInterceptors. When set, they
+	// run before them.
 	URLInterceptor     interceptor.URLInterceptor
 	RequestInterceptor interceptor.RequestInterceptor
 
+	RequestHeaderAllowList    []string
+	RequestHeaderPolicy       *RequestHeaderPolicy
+	ForwardConditionalHeaders bool
+	ForwardHopByHopHeaders    bool
+	UserAgent                 string
+	ForwardedHeaders          bool
+	ForwardedRFC7239          bool
+	TrustedProxies            []*net.IPNet
+	AuthProvider              AuthProvider
+
+	DefaultHeaders         http.Header
+	DefaultHeadersOverride bool
+
 	RequestJSONInterceptor          interceptor.JSONInterceptor
 	RequestFormInterceptor          interceptor.FormInterceptor
+	RequestFormIncludeQuery         bool
 	RequestMultipartFormInterceptor interceptor.MultipartFormInterceptor
+	RequestXMLInterceptor           interceptor.XMLInterceptor
+	RequestKeyCase                  CaseDirection
+
+	RateLimiter      *rate.Limiter
+	HostRateLimiters map[string]*rate.Limiter
+
+	HostPolicies map[string]HostPolicy
+	RetryPolicy  *retry.Policy
+	HedgePolicy  *retry.HedgePolicy
+	RoundTripper http.RoundTripper
+
+	HealthProbePath     string
+	HealthProbeInterval time.Duration
+
+	PathTemplate string
+
+	WebSocketSubprotocols []string
+
+	RequestSigner       func(*http.Request) error
+	RequestBodyEncoding string
+
+	ConcurrencyLimiter  *ConcurrencyLimiter
+	ConcurrencyFailFast bool
+
+	ExhaustionStatus     int
+	ExhaustionRetryAfter time.Duration
+
+	DeferResponseWrite  bool
+	DeferredErrorStatus int
+
+	ErrorHandler ErrorHandler
+
+	Observer Observer
+	Trace    bool
+
+	PreHandler PreHandler
+
+	JSONUseNumber bool
+	OrderedJSON   bool
 
 	ResponseJSONInterceptor interceptor.JSONInterceptor
-	TransferResponseHeaders []string
+	ResponseXMLInterceptor  interceptor.XMLInterceptor
+
+	ResponseJSONArrayInterceptor  interceptor.JSONArrayElementInterceptor
+	ResponseJSONStreamInterceptor interceptor.JSONStreamInterceptor
+	ResponseCSVInterceptor        interceptor.CSVInterceptor
+	ErrorResponseInterceptor      interceptor.ErrorResponseInterceptor
+	ResponseStatusInterceptor     interceptor.ResponseStatusInterceptor
+	ResponseInterceptors          []interceptor.ResponseInterceptor
+	ResponseBodyTransformer       interceptor.ResponseBodyTransformer
+	ResponseBodyTransformTypes    []string
+	StandardErrorBodies           map[int]interface{}
+	ErrorOnNon2xx                 bool
+	ResponseKeyCase               CaseDirection
+	TransferResponseHeaders       []string
+	TransferAllResponseHeaders    bool
+	ResponseHeaderDenyList        []string
+	MaxResponseHeaderBytes        int
+	FailOnLargeResponseHeaders    bool
+	LocationRewriter              func(string) string
+
+	ctx context.Context
 }
 
 type Option func(*Options)
 
+// AuthProvider returns the value of the Authorization header sent upstream.
+type AuthProvider func(context.Context) (string, error)
+
+// UpstreamResolver returns the base URL of the upstream for the incoming
+// request. An error aborts the request before anything is sent.
+type UpstreamResolver func(*http.Request) (*url.URL, error)
+
+// SetContext sets the incoming request context given to context interceptors.
+// It's set by the client when proxying.
+func (o *Options) SetContext(ctx context.Context) {
+	o.ctx = ctx
+}
+
+func (o *Options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+
+	return o.ctx
+}
+
 func WithMaxUploadSize(size int64) Option {
 	return func(o *Options) {
 		o.MaxUploadSize = size
 	}
 }
 
+// WithMultipartStorage copies multipart request bodies part by part,
+// keeping up to MaxUploadSize in memory (32MiB if unset) and the rest in a temp
+// file in dir, removed once the request is sent.
+func WithMultipartStorage(dir string) Option {
+	return func(o *Options) {
+		o.MultipartStorageDir = dir
+	}
+}
+
+// WithInMemoryMultipart copies multipart request bodies part by part without
+// using the disk. Bodies larger than MaxUploadSize (32MiB if unset) are
+// rejected with ErrRequestTooLarge.
+func WithInMemoryMultipart() Option {
+	return func(o *Options) {
+		o.MultipartInMemory = true
+	}
+}
+
+// WithDecompressRequest decodes gzip and deflate request bodies before they
+// are parsed and forwarded. The decoded size is bounded by MaxUploadSize
+// (32MiB if unset), and larger bodies fail with ErrRequestTooLarge.
+func WithDecompressRequest() Option {
+	return func(o *Options) {
+		o.DecompressRequest = true
+	}
+}
+
 func WithRequestTimeout(timeout time.Duration) Option {
 	return func(o *Options) {
 		o.RequestTimeout = timeout
 	}
 }
 
+// WithTimeout bounds each upstream attempt of the call, until the response
+// body is read, instead of the client request timeout. A timeout of 0 or less
+// disables it, e.g. for slow uploads.
+func WithTimeout(timeout time.Duration) Option {
+	if timeout <= 0 {
+		timeout = -1
+	}
+
+	return func(o *Options) {
+		o.RequestTimeout = timeout
+	}
+}
+
+// WithTotalDeadline bounds the whole proxy call, including retries, backoff
+// and rate limiter waits, and reading the response body. The request timeout
+// still bounds each attempt. ErrTotalDeadlineExceeded is returned, and a 504
+// is written, when it's exceeded before the response.
+func WithTotalDeadline(d time.Duration) Option {
+	return func(o *Options) {
+		o.TotalDeadline = d
+	}
+}
+
+// WithCustomMethods allows methods other than the standard HTTP ones, such as
+// WebDAV ones. Methods are uppercased either way.
+func WithCustomMethods() Option {
+	return func(o *Options) {
+		o.AllowCustomMethods = true
+	}
+}
+
+// WithStripPathPrefix strips the prefix from the incoming request path when
+// proxying transparently (with an empty path). When the path doesn't start
+// with the prefix, ErrPathNotFound is returned, after writing a 404 or the
+// response of the error handler.
+func WithStripPathPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.StripPathPrefix = prefix
+	}
+}
+
+// WithPathPrefix prepends the prefix to the proxied path.
+func WithPathPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.PathPrefix = prefix
+	}
+}
+
+// WithPathRewrite replaces the prefix of the proxied path, e.g. to forward
+// /v1/ads/... to /api/v3/.... The first matching rewrite applies, after the
+// prefix is stripped and before the path prefix is prepended.
+func WithPathRewrite(prefixFrom, prefixTo string) Option {
+	return AppendPathRewrites(PathRewrite{Prefix: prefixFrom, Replacement: prefixTo})
+}
+
+// WithPathRewriteRegexp replaces the matches of re in the proxied path, like
+// WithPathRewrite.
+func WithPathRewriteRegexp(re *regexp.Regexp, replacement string) Option {
+	return AppendPathRewrites(PathRewrite{Regexp: re, Replacement: replacement})
+}
+
+func AppendPathRewrites(rewrites ...PathRewrite) Option {
+	return func(o *Options) {
+		all := make([]PathRewrite, len(o.PathRewrites), len(o.PathRewrites)+len(rewrites))
+		copy(all, o.PathRewrites)
+
+		o.PathRewrites = append(all, rewrites...)
+	}
+}
+
+// WithMaxResponseHeaderBytes limits the total size of the response headers
+// transferred from the upstream. Headers past the limit are dropped, or with
+// fail, ErrResponseHeadersTooLarge is returned before anything is written.
+func WithMaxResponseHeaderBytes(n int, fail bool) Option {
+	return func(o *Options) {
+		o.MaxResponseHeaderBytes = n
+		o.FailOnLargeResponseHeaders = fail
+	}
+}
+
+// WithLocationRewriter rewrites the Location header of redirect responses
+// passed through to the client, and their Content-Location header if it's
+// transferred. Headers that aren't valid URLs are left as is.
+func WithLocationRewriter(rewrite func(loc string) string) Option {
+	return func(o *Options) {
+		o.LocationRewriter = rewrite
+	}
+}
+
+// WithFollowRedirects makes the proxy follow upstream redirects. By default
+// redirects are passed through to the client unchanged.
+func WithFollowRedirects(follow bool) Option {
+	return func(o *Options) {
+		o.FollowRedirects = follow
+	}
+}
+
+// WithCopyBufferSize sets the size of the buffer used to copy the upstream
+// response to the client. Buffers are pooled per size.
+func WithCopyBufferSize(size int) Option {
+	return func(o *Options) {
+		o.CopyBufferSize = size
+	}
+}
+
+// WithMaxResponseBytes limits the decompressed size of response bodies
+// buffered or streamed by response interceptors. ErrResponseTooLarge is
+// returned when it's exceeded.
+func WithMaxResponseBytes(n int64) Option {
+	return func(o *Options) {
+		o.MaxResponseBytes = n
+	}
+}
+
+// WithCache serves GET and HEAD requests from the cache when possible, and
+// caches cacheable upstream responses for ttl, unless they are marked
+// Cache-Control: no-store or private. Responses are keyed by method and the
+// upstream URL, after the URL interceptors and upstream resolver, the request
+// credentials (Authorization, Cookie and Proxy-Authorization
+// headers), and the request headers given to WithCacheVary.
+//
+// A ttl of 0 or less uses the freshness lifetime of each response instead,
+// from its Cache-Control s-maxage or max-age directive, or its Expires header.
+// Responses without one aren't cached then.
+//
+// Stale responses with an ETag are kept for another ttl, and revalidated with
+// If-None-Match: a 304 from the upstream serves the cached response again.
+func WithCache(cache CacheStore, ttl time.Duration) Option {
+	return func(o *Options) {
+		o.Cache = cache
+		o.CacheTTL = ttl
+	}
+}
+
+// WithCacheVary adds the request headers to the cache keys. Responses varying
+// on other headers than these, or Accept-Encoding, aren't cached.
+func WithCacheVary(headers ...string) Option {
+	return func(o *Options) {
+		vary := make([]string, len(o.CacheVary), len(o.CacheVary)+len(headers))
+		copy(vary, o.CacheVary)
+
+		for _, h := range headers {
+			vary = append(vary, http.CanonicalHeaderKey(h))
+		}
+		o.CacheVary = vary
+	}
+}
+
+// WithCacheMaxObjectSize sets the max decompressed body size of the cached
+// responses, 1MiB by default. Larger responses are streamed, and not cached.
+func WithCacheMaxObjectSize(n int64) Option {
+	return func(o *Options) {
+		o.CacheMaxObjectSize = n
+	}
+}
+
+// WithSingleflight makes concurrent GET and HEAD requests with the same key
+// share a single upstream request. keyFunc defaults to the method, the
+// upstream URL, the request credentials like for WithCache, and the headers
+// given to WithSingleflightHeaders. A custom keyFunc must tell users apart
+// itself.
+//
+// The shared request isn't cancelled along with the incoming request that
+// started it, it's bounded by the request timeout instead. Each request stops
+// waiting for it when cancelled.
+func WithSingleflight(keyFunc func(*http.Request) string) Option {
+	return func(o *Options) {
+		o.Singleflight = true
+		o.SingleflightKeyFunc = keyFunc
+	}
+}
+
+// WithSingleflightHeaders adds the request headers to the default singleflight
+// key, so that only requests with the same values share a response. Headers
+// the response depends on, other than the credentials, must be given.
+func WithSingleflightHeaders(headers ...string) Option {
+	return func(o *Options) {
+		keyHeaders := make([]string, len(o.SingleflightHeaders), len(o.SingleflightHeaders)+len(headers))
+		copy(keyHeaders, o.SingleflightHeaders)
+
+		for _, h := range headers {
+			keyHeaders = append(keyHeaders, http.CanonicalHeaderKey(h))
+		}
+		o.SingleflightHeaders = keyHeaders
+	}
+}
+
+// WithSingleflightMaxBytes sets the max size of a shared response body,
+// defaults to 1MiB. Larger responses aren't shared.
+func WithSingleflightMaxBytes(n int64) Option {
+	return func(o *Options) {
+		o.SingleflightMaxBytes = n
+	}
+}
+
+// WithCompressResponse gzips responses that the upstream didn't encode, for
+// clients accepting gzip. Responses known to be smaller than the min size are
+// left uncompressed, as well as already compressed media types, like images.
+func WithCompressResponse() Option {
+	return func(o *Options) {
+		o.CompressResponse = true
+	}
+}
+
+// WithRecompressResponse compresses again the responses the upstream encoded,
+// once decoded to be intercepted, with the same content coding if the client
+// accepts it, or else br, zstd or gzip, in that order. Like for
+// WithCompressResponse, responses smaller than the min size are left
+// uncompressed.
+func WithRecompressResponse() Option {
+	return func(o *Options) {
+		o.RecompressResponse = true
+	}
+}
+
+// WithHonorAcceptEncoding decodes passed through responses whose content
+// coding isn't accepted by the client, e.g. gzip responses for clients
+// sending no Accept-Encoding or Accept-Encoding: identity.
+func WithHonorAcceptEncoding() Option {
+	return func(o *Options) {
+		o.HonorAcceptEncoding = true
+	}
+}
+
+// WithUpstreamAcceptEncoding sends the upstream requests with an
+// Accept-Encoding of the content codings, e.g. "br", "zstd", "gzip", instead
+// of the client's. Responses are decoded when intercepted, or when the client
+// doesn't accept their coding, like with WithHonorAcceptEncoding.
+func WithUpstreamAcceptEncoding(codings ...string) Option {
+	return func(o *Options) {
+		o.UpstreamAcceptEncoding = codings
+		o.HonorAcceptEncoding = true
+	}
+}
+
+// WithCompressMinSize sets the min response size for WithCompressResponse,
+// defaults to 1KiB.
+func WithCompressMinSize(n int64) Option {
+	return func(o *Options) {
+		o.CompressMinSize = n
+	}
+}
+
+// WithUpstreamResolver sets the base URL of the upstream per request,
+// overriding the client base URL. A nil URL keeps the client base URL.
+func WithUpstreamResolver(resolver UpstreamResolver) Option {
+	return func(o *Options) {
+		o.UpstreamResolver = resolver
+	}
+}
+
+// WithURLInterceptor replaces the URL interceptors with intcp.
 func WithURLInterceptor(intcp interceptor.URLInterceptor) Option {
 	return func(o *Options) {
-		o.URLInterceptor = intcp
+		o.URLInterceptor = nil
+		o.URLInterceptors = []interceptor.URLInterceptor{intcp}
+	}
+}
+
+// AppendURLInterceptor adds URL interceptors, run in order after the previous
+// ones.
+func AppendURLInterceptor(intcps ...interceptor.URLInterceptor) Option {
+	return func(o *Options) {
+		intercepts := make([]interceptor.URLInterceptor, len(o.URLInterceptors), len(o.URLInterceptors)+len(intcps))
+		copy(intercepts, o.URLInterceptors)
+
+		o.URLInterceptors = append(intercepts, intcps...)
+	}
+}
+
+// WithQueryInterceptor changes the query parameters of the proxied URL, after
+// the previously added query interceptors. It runs before the upstream
+// request is built, so before the URL interceptors.
+func WithQueryInterceptor(intcp interceptor.QueryInterceptor) Option {
+	return func(o *Options) {
+		intercepts := make([]interceptor.QueryInterceptor, len(o.QueryInterceptors), len(o.QueryInterceptors)+1)
+		copy(intercepts, o.QueryInterceptors)
+
+		o.QueryInterceptors = append(intercepts, intcp)
 	}
 }
 
+// WithStaticQueryParams sets the query parameters on the proxied URL,
+// replacing those sent by the client.
+func WithStaticQueryParams(params map[string]string) Option {
+	static := make(map[string]string, len(params))
+	for k, v := range params {
+		static[k] = v
+	}
+
+	return WithQueryInterceptor(func(query url.Values) url.Values {
+		for k, v := range static {
+			query.Set(k, v)
+		}
+
+		return query
+	})
+}
+
+// WithRequestInterceptor replaces the request interceptors with intcp.
 func WithRequestInterceptor(intcp interceptor.RequestInterceptor) Option {
 	return func(o *Options) {
-		o.RequestInterceptor = intcp
+		o.RequestInterceptor = nil
+		o.RequestInterceptors = []interceptor.RequestInterceptor{intcp}
+	}
+}
+
+// AppendRequestInterceptor adds request interceptors, run in order after the
+// previous ones.
+func AppendRequestInterceptor(intcps ...interceptor.RequestInterceptor) Option {
+	return func(o *Options) {
+		intercepts := make([]interceptor.RequestInterceptor, len(o.RequestInterceptors), len(o.RequestInterceptors)+len(intcps))
+		copy(intercepts, o.RequestInterceptors)
+
+		o.RequestInterceptors = append(intercepts, intcps...)
+	}
+}
+
+// AppendContextRequestInterceptors appends request interceptors given the
+// context of the upstream request, which carries the values of the incoming
+// request context.
+func AppendContextRequestInterceptors(intcps ...interceptor.ContextRequestInterceptor) Option {
+	return func(o *Options) {
+		intercepts := make([]interceptor.RequestInterceptor, len(o.RequestInterceptors), len(o.RequestInterceptors)+len(intcps))
+		copy(intercepts, o.RequestInterceptors)
+
+		for _, intcp := range intcps {
+			intcp := intcp
+			intercepts = append(intercepts, func(r *http.Request) {
+				intcp(r.Context(), r)
+			})
+		}
+		o.RequestInterceptors = intercepts
+	}
+}
+
+// WithRequestRewriter sets a rewriter that can replace the upstream request
+// body. It's called right before the request is sent, after the body has been
+// built by the request body interceptors and after the request interceptors.
+func WithRequestRewriter(rewriter interceptor.RequestRewriter) Option {
+	return func(o *Options) {
+		o.RequestRewriter = rewriter
+	}
+}
+
+// WithRequestHeaderAllowList forwards only the given inbound headers upstream,
+// instead of forwarding all of them.
+func WithRequestHeaderAllowList(headers ...string) Option {
+	return func(o *Options) {
+		o.RequestHeaderAllowList = make([]string, len(headers))
+
+		copy(o.RequestHeaderAllowList, headers)
+	}
+}
+
+// WithConditionalRequestHeaders forwards the conditional request headers, such
+// as If-None-Match, even if the allow list or the header policy doesn't allow
+// them. The header policy can still strip them.
+func WithConditionalRequestHeaders() Option {
+	return func(o *Options) {
+		o.ForwardConditionalHeaders = true
+	}
+}
+
+// WithHMACSigning signs the upstream requests like request.WithHMACSigning.
+// Request bodies that are streamed are buffered in memory to be hashed.
+func WithHMACSigning(keyID, secret string, algo request.HMACAlgorithm) Option {
+	return func(o *Options) {
+		o.RequestSigner = request.HMACSigner(keyID, secret, algo)
+	}
+}
+
+// WithCompressRequestBody compresses the upstream request bodies with the
+// content coding, "gzip" or "zstd", like request.WithGzipRequestBody. Form
+// and multipart bodies are compressed as they're built, and bodies passed
+// through with a Content-Encoding are left as is.
+func WithCompressRequestBody(coding string) Option {
+	return func(o *Options) {
+		o.RequestBodyEncoding = coding
+	}
+}
+
+// WithRequestHeaderPolicy filters and rewrites the inbound headers forwarded
+// upstream with the policy. It applies on top of the allow list.
+func WithRequestHeaderPolicy(policy RequestHeaderPolicy) Option {
+	return func(o *Options) {
+		if policy.Rename != nil {
+			rename := make(map[string]string, len(policy.Rename))
+			for from, to := range policy.Rename {
+				rename[http.CanonicalHeaderKey(from)] = to
+			}
+			policy.Rename = rename
+		}
+		if policy.Set != nil {
+			set := make(http.Header, len(policy.Set))
+			for k, vv := range policy.Set {
+				for _, v := range vv {
+					set.Add(k, v)
+				}
+			}
+			policy.Set = set
+		}
+
+		o.RequestHeaderPolicy = &policy
+	}
+}
+
+// WithoutHopByHopFiltering forwards the hop-by-hop headers of the incoming
+// request, such as Connection and the headers it lists, which are stripped by
+// default. Protocol upgrades are forwarded either way.
+func WithoutHopByHopFiltering() Option {
+	return func(o *Options) {
+		o.ForwardHopByHopHeaders = true
+	}
+}
+
+// WithForwardedHeaders sets X-Forwarded-For, X-Forwarded-Host and
+// X-Forwarded-Proto on the upstream request, and with rfc7239, the Forwarded
+// header. The incoming forwarding headers are dropped, unless the peer is a
+// trusted proxy, in which case they are kept and appended to.
+func WithForwardedHeaders(rfc7239 bool) Option {
+	return func(o *Options) {
+		o.ForwardedHeaders = true
+		o.ForwardedRFC7239 = rfc7239
+	}
+}
+
+// WithTrustedProxies sets the networks of the proxies whose forwarding headers
+// are kept by WithForwardedHeaders.
+func WithTrustedProxies(networks ...*net.IPNet) Option {
+	return func(o *Options) {
+		o.TrustedProxies = append([]*net.IPNet(nil), networks...)
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent upstream, instead of the
+// incoming one.
+func WithUserAgent(userAgent string) Option {
+	return func(o *Options) {
+		o.UserAgent = userAgent
+	}
+}
+
+// WithDefaultHeaders adds the headers to the upstream request. Headers
+// forwarded from the incoming request are kept, unless override is true.
+// Host is ignored, it can be changed with a request interceptor.
+func WithDefaultHeaders(headers http.Header, override bool) Option {
+	return func(o *Options) {
+		o.DefaultHeaders = headers.Clone()
+		o.DefaultHeaders.Del("Host")
+		o.DefaultHeadersOverride = override
+	}
+}
+
+// WithBearerToken sends the token as bearer Authorization header upstream,
+// replacing any Authorization header from the incoming request.
+func WithBearerToken(token string) Option {
+	return WithAuthProvider(func(context.Context) (string, error) {
+		return "Bearer " + token, nil
+	})
+}
+
+// WithAuthProvider sets the Authorization header sent upstream from the
+// provider, replacing any Authorization header from the incoming request.
+// The request is not sent when the provider fails.
+func WithAuthProvider(provider AuthProvider) Option {
+	return func(o *Options) {
+		o.AuthProvider = provider
 	}
 }
 
@@ -53,24 +680,354 @@ func WithRequestJSONInterceptor(intcp interceptor.JSONInterceptor) Option {
 	}
 }
 
+// WithRequestJSONContextInterceptor is like WithRequestJSONInterceptor, with
+// the interceptor given the incoming request context.
+func WithRequestJSONContextInterceptor(intcp interceptor.ContextJSONInterceptor) Option {
+	return func(o *Options) {
+		o.RequestJSONInterceptor = func(v interface{}) (interface{}, error) {
+			return intcp(o.context(), v)
+		}
+	}
+}
+
 func WithRequestFormInterceptor(intcp interceptor.FormInterceptor) Option {
 	return func(o *Options) {
 		o.RequestFormInterceptor = intcp
 	}
 }
 
+// WithRequestFormContextInterceptor is like WithRequestFormInterceptor, with
+// the interceptor given the incoming request context.
+func WithRequestFormContextInterceptor(intcp interceptor.ContextFormInterceptor) Option {
+	return func(o *Options) {
+		o.RequestFormInterceptor = func(form url.Values) (url.Values, error) {
+			return intcp(o.context(), form)
+		}
+	}
+}
+
+// WithRequestFormIncludeQuery makes the forwarded form, and the form passed to
+// the form interceptor, contain the URL query values as well as the body
+// values. The query values are encoded into the request body, the URL query
+// is still forwarded as is.
+func WithRequestFormIncludeQuery() Option {
+	return func(o *Options) {
+		o.RequestFormIncludeQuery = true
+	}
+}
+
+// WithRequestMultipartFormInterceptor appends what the interceptor writes to
+// the parts of multipart request bodies. It's run before the upstream request
+// is sent, so its error fails the request before any of the body is sent.
 func WithRequestMultipartFormInterceptor(intcp interceptor.MultipartFormInterceptor) Option {
 	return func(o *Options) {
 		o.RequestMultipartFormInterceptor = intcp
 	}
 }
 
+func WithRequestXMLInterceptor(intcp interceptor.XMLInterceptor) Option {
+	return func(o *Options) {
+		o.RequestXMLInterceptor = intcp
+	}
+}
+
+// WithJSONUseNumber decodes JSON numbers as json.Number instead of float64
+// for the request and response JSON interceptors, so that large integers
+// round-trip exactly. Interceptors must then expect json.Number values.
+func WithJSONUseNumber() Option {
+	return func(o *Options) {
+		o.JSONUseNumber = true
+	}
+}
+
+// WithOrderedJSON decodes JSON objects as OrderedMap instead of
+// map[string]interface{} for the request and response JSON interceptors, so
+// that keys are encoded back in their original order.
+func WithOrderedJSON() Option {
+	return func(o *Options) {
+		o.OrderedJSON = true
+	}
+}
+
+// WithResponseJSONInterceptor intercepts JSON response bodies. Responses with
+// a Content-Type that isn't JSON, such as application/json or a +json type,
+// are passed through.
 func WithResponseJSONInterceptor(intcp interceptor.JSONInterceptor) Option {
 	return func(o *Options) {
 		o.ResponseJSONInterceptor = intcp
 	}
 }
 
+// WithResponseJSONContextInterceptor is like WithResponseJSONInterceptor, with
+// the interceptor given the incoming request context.
+func WithResponseJSONContextInterceptor(intcp interceptor.ContextJSONInterceptor) Option {
+	return func(o *Options) {
+		o.ResponseJSONInterceptor = func(v interface{}) (interface{}, error) {
+			return intcp(o.context(), v)
+		}
+	}
+}
+
+// WithResponseJSONArrayInterceptor streams a JSON array response element by
+// element through the interceptor, without buffering the whole body. An
+// element is dropped when the interceptor returns nil. Responses that aren't
+// a JSON array are handled by the response JSON interceptor instead, and ones
+// with a Content-Type that isn't JSON are passed through.
+func WithResponseJSONArrayInterceptor(intcp interceptor.JSONArrayElementInterceptor) Option {
+	return func(o *Options) {
+		o.ResponseJSONArrayInterceptor = intcp
+	}
+}
+
+// WithResponseJSONStreamInterceptor streams a JSON response through the
+// interceptor, which writes the transformed body directly to the client. It
+// takes precedence over the other response JSON interceptors. Responses with
+// a Content-Type that isn't JSON are passed through.
+func WithResponseJSONStreamInterceptor(intcp interceptor.JSONStreamInterceptor) Option {
+	return func(o *Options) {
+		o.ResponseJSONStreamInterceptor = intcp
+	}
+}
+
+// WithResponseCSVInterceptor streams a CSV response row by row through the
+// interceptor. A row is dropped when the interceptor returns nil or
+// ErrSkipRow. Responses with a Content-Type that isn't CSV are passed through.
+func WithResponseCSVInterceptor(intcp interceptor.CSVInterceptor) Option {
+	return func(o *Options) {
+		o.ResponseCSVInterceptor = intcp
+	}
+}
+
+// WithResponseStatusInterceptor remaps the status code and changes the
+// headers of the response right before they're written. Setting the
+// Content-Length header to 0, or a status without body, drops the body.
+func WithResponseStatusInterceptor(intcp interceptor.ResponseStatusInterceptor) Option {
+	return func(o *Options) {
+		o.ResponseStatusInterceptor = intcp
+	}
+}
+
+// AppendResponseInterceptors runs the interceptors in order on the upstream
+// response, before anything else is done with it.
+func AppendResponseInterceptors(intcps ...interceptor.ResponseInterceptor) Option {
+	return func(o *Options) {
+		intercepts := make([]interceptor.ResponseInterceptor, len(o.ResponseInterceptors), len(o.ResponseInterceptors)+len(intcps))
+		copy(intercepts, o.ResponseInterceptors)
+
+		o.ResponseInterceptors = append(intercepts, intcps...)
+	}
+}
+
+// WithResponseBodyTransformer streams the response bodies with a media type
+// matching one of the patterns, or every body if none is given, through the
+// transformer, after the other response interceptors. A pattern ending with
+// "*" matches a prefix, e.g. "text/*". Bodies are decompressed first, and
+// those with an encoding that can't be decoded are left as is.
+func WithResponseBodyTransformer(transformer interceptor.ResponseBodyTransformer, mediaTypes ...string) Option {
+	return func(o *Options) {
+		o.ResponseBodyTransformer = transformer
+		o.ResponseBodyTransformTypes = mediaTypes
+	}
+}
+
+// WithErrorResponseInterceptor rewrites the body and, if the returned status
+// is not 0, the status of non-2xx responses. It takes precedence over the
+// other response interceptors for those responses. The body is the decoded
+// JSON, the raw string if it isn't JSON, or nil if it's empty.
+func WithErrorResponseInterceptor(intcp interceptor.ErrorResponseInterceptor) Option {
+	return func(o *Options) {
+		o.ErrorResponseInterceptor = intcp
+	}
+}
+
+// WithStandardErrorBody replaces the body of non-2xx responses with the
+// status codes in bodies by the JSON encoding of the given body. It takes
+// precedence over the error response interceptor.
+func WithStandardErrorBody(bodies map[int]interface{}) Option {
+	return func(o *Options) {
+		o.StandardErrorBodies = bodies
+	}
+}
+
+// WithErrorOnNon2xx makes ProxyAPIResponse return non-2xx responses as
+// *api_client.APIError, with the response body closed. It's ignored by the
+// helpers writing the response.
+func WithErrorOnNon2xx() Option {
+	return func(o *Options) {
+		o.ErrorOnNon2xx = true
+	}
+}
+
+// WithResponseXMLInterceptor intercepts XML response bodies. Responses with a
+// Content-Type that isn't XML are passed through.
+func WithResponseXMLInterceptor(intcp interceptor.XMLInterceptor) Option {
+	return func(o *Options) {
+		o.ResponseXMLInterceptor = intcp
+	}
+}
+
+// WithKeyCaseTransform converts JSON object keys of the request body in the
+// given direction, and keys of the response body in the reverse direction.
+// Keys are converted after the JSON interceptors run.
+func WithKeyCaseTransform(direction CaseDirection) Option {
+	return func(o *Options) {
+		o.RequestKeyCase = direction
+		o.ResponseKeyCase = direction.Reverse()
+	}
+}
+
+func WithRequestKeyCaseTransform(direction CaseDirection) Option {
+	return func(o *Options) {
+		o.RequestKeyCase = direction
+	}
+}
+
+func WithResponseKeyCaseTransform(direction CaseDirection) Option {
+	return func(o *Options) {
+		o.ResponseKeyCase = direction
+	}
+}
+
+// WithRateLimiter makes every proxied request wait for the limiter before it
+// is sent upstream.
+func WithRateLimiter(limiter *rate.Limiter) Option {
+	return func(o *Options) {
+		o.RateLimiter = limiter
+	}
+}
+
+// WithHostRateLimiters is like WithRateLimiter, with a limiter per upstream
+// host, keyed by the host[:port] of the outbound URL. It takes precedence
+// over WithRateLimiter for the hosts it contains.
+func WithHostRateLimiters(limiters map[string]*rate.Limiter) Option {
+	return func(o *Options) {
+		o.HostRateLimiters = limiters
+	}
+}
+
+// WithHealthProbe probes the path of the client upstreams, the load balancer
+// endpoints or the base URL, every interval in the background. Unhealthy
+// endpoints are taken out of rotation until they respond with a 2xx again.
+// The probes start with the first request proxied with the option, unless the
+// client already has health checks, see the client WithHealthCheck option,
+// and run until Client.Shutdown.
+func WithHealthProbe(path string, interval time.Duration) Option {
+	return func(o *Options) {
+		o.HealthProbePath = path
+		o.HealthProbeInterval = interval
+	}
+}
+
+// WithHostPolicy applies the policies by upstream host, keyed by the
+// host[:port] of the outbound URL.
+func WithHostPolicy(policies map[string]HostPolicy) Option {
+	return func(o *Options) {
+		o.HostPolicies = policies
+	}
+}
+
+// WithRetryPolicy retries upstream requests, overriding the client's retry
+// policy. Request bodies are buffered up to the policy's MaxBufferBytes so
+// that they can be sent again. Retries apply on top of host policies.
+func WithRetryPolicy(policy retry.Policy) Option {
+	return func(o *Options) {
+		o.RetryPolicy = &policy
+	}
+}
+
+// WithHedging hedges slow upstream requests with idempotent methods. Request
+// bodies are buffered like for WithRetryPolicy, so that they can be sent
+// twice.
+func WithHedging(policy retry.HedgePolicy) Option {
+	return func(o *Options) {
+		o.HedgePolicy = &policy
+	}
+}
+
+// WithPathTemplate labels the metrics of the upstream request with the
+// template, e.g. "/users/{id}", instead of the path.
+func WithPathTemplate(template string) Option {
+	return func(o *Options) {
+		o.PathTemplate = template
+	}
+}
+
+// WithRoundTripper sends the upstream requests with the transport, instead of
+// the client's one. Host policies apply on top of it.
+func WithRoundTripper(rt http.RoundTripper) Option {
+	return func(o *Options) {
+		o.RoundTripper = rt
+	}
+}
+
+// WithMaxConcurrency limits the number of in-flight upstream requests with
+// the limiter. Requests wait for a slot until the incoming request is done,
+// or with failFast, fail immediately with a 503 when all slots are taken.
+func WithMaxConcurrency(limiter *ConcurrencyLimiter, failFast bool) Option {
+	return func(o *Options) {
+		o.ConcurrencyLimiter = limiter
+		o.ConcurrencyFailFast = failFast
+	}
+}
+
+// WithExhaustionResponse writes a response with the given status and a
+// Retry-After hint when all attempts to reach the upstream failed. Requests
+// cancelled by the client aren't considered exhausted.
+func WithExhaustionResponse(status int, retryAfter time.Duration) Option {
+	return func(o *Options) {
+		o.ExhaustionStatus = status
+		o.ExhaustionRetryAfter = retryAfter
+	}
+}
+
+// WithDeferredResponseWrite buffers the whole response, and writes its status
+// and headers only once the response interceptors succeeded. When they fail,
+// a response with the error status, 502 if 0, is written instead. Responses
+// aren't streamed to the client then.
+func WithDeferredResponseWrite(errorStatus int) Option {
+	return func(o *Options) {
+		o.DeferResponseWrite = true
+		o.DeferredErrorStatus = errorStatus
+	}
+}
+
+// WithTrace notifies the observer of the timings of each upstream request
+// attempt, with an EventTypeTimings event.
+func WithTrace() Option {
+	return func(o *Options) {
+		o.Trace = true
+	}
+}
+
+// WithErrorHandler writes the response with h when the request couldn't be
+// proxied, or the response interceptors failed before anything was written.
+// The built-in 429, 503, 504 and exhaustion responses are still written for
+// the errors they cover. A nil h is JSONErrorHandler.
+func WithErrorHandler(h ErrorHandler) Option {
+	if h == nil {
+		h = JSONErrorHandler
+	}
+
+	return func(o *Options) {
+		o.ErrorHandler = h
+	}
+}
+
+func WithPreHandler(h PreHandler) Option {
+	return func(o *Options) {
+		o.PreHandler = h
+	}
+}
+
+func WithObserver(observer Observer) Option {
+	return func(o *Options) {
+		o.Observer = observer
+	}
+}
+
+// WithTransferResponseHeaders transfers the upstream response headers with the
+// names, matched case-insensitively. A name ending with "*" is a prefix, e.g.
+// "X-RateLimit-*". Hop-by-hop headers are never transferred.
 func WithTransferResponseHeaders(headers ...string) Option {
 	return func(o *Options) {
 		o.TransferResponseHeaders = make([]string, len(headers))
@@ -90,3 +1047,32 @@ func AppendTransferResponseHeaders(headers ...string) Option {
 		}
 	}
 }
+
+// WithTransferAllResponseHeaders transfers all the upstream response headers,
+// except the hop-by-hop ones and the ones matching the deny list, with the
+// same patterns as WithTransferResponseHeaders.
+func WithTransferAllResponseHeaders(deny ...string) Option {
+	return func(o *Options) {
+		o.TransferAllResponseHeaders = true
+		o.ResponseHeaderDenyList = append(o.ResponseHeaderDenyList, deny...)
+	}
+}
+
+// WithResponseHeaderDenyList never transfers the upstream response headers
+// matching the patterns, e.g. "Set-Cookie" or "X-Internal-*".
+func WithResponseHeaderDenyList(patterns ...string) Option {
+	return func(o *Options) {
+		o.ResponseHeaderDenyList = append(o.ResponseHeaderDenyList, patterns...)
+	}
+}
+
+// WithWebSocketSubprotocols only offers the allowed subprotocols among the
+// client's ones to the upstream, when proxying a WebSocket. The handshake
+// fails if the upstream selects a subprotocol that wasn't offered.
+func WithWebSocketSubprotocols(protocols ...string) Option {
+	return func(o *Options) {
+		o.WebSocketSubprotocols = make([]string, len(protocols))
+
+		copy(o.WebSocketSubprotocols, protocols)
+	}
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedMap is a JSON object that keeps the order of its keys. Interceptors
+// receive it in place of map[string]interface{} when WithOrderedJSON is used.
+type OrderedMap []KeyValue
+
+func (m OrderedMap) Get(key string) (interface{}, bool) {
+	for _, kv := range m {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// Set replaces the value of key, or appends it if there's none.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	for i, kv := range *m {
+		if kv.Key == key {
+			(*m)[i].Value = value
+			return
+		}
+	}
+
+	*m = append(*m, KeyValue{Key: key, Value: value})
+}
+
+func (m *OrderedMap) Delete(key string) {
+	for i, kv := range *m {
+		if kv.Key == key {
+			*m = append((*m)[:i], (*m)[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m OrderedMap) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+
+	for i, kv := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// DecodeOrderedJSON decodes the next JSON value from the decoder, with
+// objects decoded as OrderedMap.
+func DecodeOrderedJSON(decoder *json.Decoder) (interface{}, error) {
+	tok, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeOrderedValue(decoder, tok)
+}
+
+func decodeOrderedValue(decoder *json.Decoder, tok json.Token) (interface{}, error) {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		m := OrderedMap{}
+		for decoder.More() {
+			keyTok, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				return nil, fmt.Errorf("proxy: unexpected JSON object key %v", keyTok)
+			}
+
+			value, err := DecodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			m = append(m, KeyValue{Key: key, Value: value})
+		}
+
+		// consume the closing brace
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+
+		return m, nil
+	case '[':
+		arr := []interface{}{}
+		for decoder.More() {
+			value, err := DecodeOrderedJSON(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, value)
+		}
+
+		// consume the closing bracket
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("proxy: unexpected JSON delimiter %v", delim)
+	}
+}
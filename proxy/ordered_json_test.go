@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOrderedJSONRoundTrip(t *testing.T) {
+	in := `{"z":1,"a":{"y":[{"q":true,"b":null}],"c":"s"},"m":[1,2]}`
+
+	obj, err := DecodeOrderedJSON(json.NewDecoder(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("DecodeOrderedJSON: %v", err)
+	}
+
+	out, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(out) != in {
+		t.Errorf("round trip = %s, want %s", out, in)
+	}
+}
+
+func TestOrderedMapSetDelete(t *testing.T) {
+	m := OrderedMap{{Key: "b", Value: 1}, {Key: "a", Value: 2}}
+
+	m.Set("b", 3)
+	m.Set("c", 4)
+	m.Delete("a")
+
+	out, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"b":3,"c":4}`; string(out) != want {
+		t.Errorf("map = %s, want %s", out, want)
+	}
+
+	if v, ok := m.Get("c"); !ok || v != 4 {
+		t.Errorf("Get(c) = %v, %v, want 4, true", v, ok)
+	}
+	if _, ok := m.Get("a"); ok {
+		t.Error("Get(a) found a deleted key")
+	}
+}
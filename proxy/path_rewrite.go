@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PathRewrite rewrites the path of the proxied requests, either by replacing
+// a path prefix, or the matches of a regular expression.
+type PathRewrite struct {
+	// Prefix is replaced with Replacement when the path starts with it, at a
+	// segment boundary.
+	Prefix string
+
+	// Regexp, when set, is used instead of Prefix. Replacement can then refer
+	// to the submatches, with $1 or ${name}.
+	Regexp *regexp.Regexp
+
+	Replacement string
+}
+
+// Rewrite returns the rewritten path, and whether the rule matched it.
+func (r PathRewrite) Rewrite(p string) (string, bool) {
+	if r.Regexp != nil {
+		if !r.Regexp.MatchString(p) {
+			return p, false
+		}
+
+		return r.Regexp.ReplaceAllString(p, r.Replacement), true
+	}
+
+	prefix := strings.TrimSuffix(r.Prefix, "/")
+
+	if p != prefix && !strings.HasPrefix(p, prefix+"/") {
+		return p, false
+	}
+
+	rewritten := strings.TrimSuffix(r.Replacement, "/") + p[len(prefix):]
+	if !strings.HasPrefix(rewritten, "/") {
+		rewritten = "/" + rewritten
+	}
+
+	return rewritten, true
+}
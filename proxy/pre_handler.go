@@ -0,0 +1,14 @@
+package proxy
+
+import "net/http"
+
+// CannedResponse is a response written instead of proxying the request.
+type CannedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// PreHandler is called before the upstream request is made. If it returns
+// true, the canned response is written and the request isn't proxied.
+type PreHandler func(*http.Request) (*CannedResponse, bool)
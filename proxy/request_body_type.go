@@ -3,8 +3,14 @@ package proxy
 type RequestBodyType string
 
 const (
-	RequestBodyTypeNone          = RequestBodyType("")
-	RequestBodyTypeRaw           = RequestBodyType("RAW")
+	// RequestBodyTypeNone doesn't forward the request body.
+	RequestBodyTypeNone = RequestBodyType("")
+
+	// RequestBodyTypeRaw forwards the request body as is. Unless a request
+	// JSON or XML interceptor is set, the body is streamed, with its length
+	// when the incoming request declares one, or chunked otherwise.
+	RequestBodyTypeRaw = RequestBodyType("RAW")
+
 	RequestBodyTypeForm          = RequestBodyType("FORM")
 	RequestBodyTypeMultipartForm = RequestBodyType("MULTIPART_FORM")
 )
@@ -0,0 +1,26 @@
+package proxy
+
+import "net/http"
+
+// RequestHeaderPolicy filters and rewrites the incoming request headers
+// forwarded upstream. Header names are matched case-insensitively, and a name
+// ending with "*" matches the names with its prefix, e.g. "X-Debug-*".
+type RequestHeaderPolicy struct {
+	// Allow, if not nil, only forwards the matching headers.
+	Allow []string
+
+	// Strip never forwards the matching headers, e.g. "Cookie".
+	Strip []string
+
+	// Rename forwards the headers under another name, keyed by their incoming
+	// name.
+	Rename map[string]string
+
+	// Set overrides headers with static values, after the other rules and the
+	// default headers.
+	Set http.Header
+
+	// PreserveHost sends the incoming Host upstream, instead of the upstream
+	// host.
+	PreserveHost bool
+}
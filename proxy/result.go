@@ -0,0 +1,20 @@
+package proxy
+
+type Result struct {
+	// StatusCode is the status code of the upstream response.
+	StatusCode int
+
+	// BytesWritten is the number of response body bytes written to the client.
+	BytesWritten int64
+
+	// BytesRead is the number of request body bytes read from the client.
+	BytesRead int64
+
+	// JSONIntercepted reports whether the response went through a JSON
+	// interceptor.
+	JSONIntercepted bool
+
+	// ShortCircuited reports whether a canned response was written by the
+	// pre-handler instead of proxying.
+	ShortCircuited bool
+}
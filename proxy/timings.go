@@ -0,0 +1,15 @@
+package proxy
+
+import "time"
+
+// Timings is the breakdown of an upstream request attempt, up to the first
+// response byte. Phases that didn't happen, e.g. with a reused connection,
+// are zero.
+type Timings struct {
+	DNSLookup       time.Duration
+	Connect         time.Duration
+	TLSHandshake    time.Duration
+	TimeToFirstByte time.Duration
+
+	ConnReused bool
+}
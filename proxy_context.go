@@ -0,0 +1,73 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// ProxyAPIContext is like ProxyAPI, but the upstream request is tied to ctx
+// instead of the incoming request context. ctx should usually be derived from
+// httpReq.Context(), so that the upstream request is still cancelled when the
+// client goes away.
+func (c *Client) ProxyAPIContext(
+	ctx context.Context,
+	method, path string,
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	reqBodyType proxy.RequestBodyType,
+	opts ...proxy.Option,
+) error {
+	return c.ProxyAPI(method, path, httpReq.WithContext(ctx), resWriter, reqBodyType, opts...)
+}
+
+func (c *Client) ProxyAPIWithResultContext(
+	ctx context.Context,
+	method, path string,
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	reqBodyType proxy.RequestBodyType,
+	opts ...proxy.Option,
+) (proxy.Result, error) {
+	return c.ProxyAPIWithResult(method, path, httpReq.WithContext(ctx), resWriter, reqBodyType, opts...)
+}
+
+func (c *Client) ProxyAPIResponseContext(
+	ctx context.Context,
+	method, path string,
+	httpReq *http.Request,
+	reqBodyType proxy.RequestBodyType,
+	opts ...proxy.Option,
+) (*http.Response, error) {
+	return c.ProxyAPIResponse(method, path, httpReq.WithContext(ctx), reqBodyType, opts...)
+}
+
+func (c *Client) ProxyXMLAPIContext(
+	ctx context.Context,
+	method, path string,
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	opts ...proxy.Option,
+) error {
+	return c.ProxyXMLAPI(method, path, httpReq.WithContext(ctx), resWriter, opts...)
+}
+
+func (c *Client) ProxyGetAPIContext(
+	ctx context.Context,
+	path string,
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	opts ...proxy.Option,
+) error {
+	return c.ProxyGetAPI(path, httpReq.WithContext(ctx), resWriter, opts...)
+}
+
+func (c *Client) TransparentProxyAPIContext(
+	ctx context.Context,
+	httpReq *http.Request,
+	resWriter http.ResponseWriter,
+	requestType proxy.RequestBodyType,
+) error {
+	return c.TransparentProxyAPI(httpReq.WithContext(ctx), resWriter, requestType)
+}
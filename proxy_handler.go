@@ -0,0 +1,31 @@
+package api_client
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// Handler returns an http.Handler proxying the incoming requests as is, with
+// their method, path, query and body, and streaming the responses back.
+// Requests that couldn't be proxied get the response of the error handler,
+// proxy.JSONErrorHandler unless an option sets one.
+func (c *Client) Handler(opts ...proxy.Option) http.Handler {
+	handlerOpts := make([]proxy.Option, 0, len(opts)+1)
+	handlerOpts = append(handlerOpts, proxy.WithErrorHandler(nil))
+	handlerOpts = append(handlerOpts, opts...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		abortOnStreamError(c.ProxyAPI("", "", r, w, proxy.RequestBodyTypeRaw, handlerOpts...))
+	})
+}
+
+// abortOnStreamError aborts the handler when the response was truncated, so
+// that the client doesn't take it as complete.
+func abortOnStreamError(err error) {
+	var streamErr *proxy.StreamError
+	if errors.As(err, &streamErr) {
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,134 @@
+package api_client
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// ProxyRoute configures how the requests matching a ProxyMux pattern are
+// proxied.
+type ProxyRoute struct {
+	// Methods are the incoming request methods routed, any method if empty.
+	// HEAD is routed along with GET.
+	Methods []string
+
+	// Method and Path override the upstream method and path, like with
+	// ProxyAPI. The incoming ones are used when empty.
+	Method string
+	Path   string
+
+	RequestBodyType proxy.RequestBodyType
+
+	// Options are applied after the mux options, e.g. interceptors and header
+	// policies.
+	Options []proxy.Option
+}
+
+// ProxyMux is an http.Handler proxying the incoming requests with the route
+// of the longest matching pattern. Like with http.ServeMux, a pattern ending
+// with a slash matches the paths it prefixes, and other patterns match the
+// path exactly.
+//
+// A request matching no pattern gets a 404, and one matching a pattern but
+// not its methods a 405. Requests that couldn't be proxied get the response
+// of the error handler, proxy.JSONErrorHandler unless an option sets one.
+type ProxyMux struct {
+	client *Client
+	opts   []proxy.Option
+
+	lock   sync.RWMutex
+	routes []muxRoute
+}
+
+type muxRoute struct {
+	pattern string
+	route   ProxyRoute
+	opts    []proxy.Option
+}
+
+// NewProxyMux returns a mux proxying with c, with the options applied to every
+// route.
+func (c *Client) NewProxyMux(opts ...proxy.Option) *ProxyMux {
+	muxOpts := make([]proxy.Option, 0, len(opts)+1)
+	muxOpts = append(muxOpts, proxy.WithErrorHandler(nil))
+
+	return &ProxyMux{client: c, opts: append(muxOpts, opts...)}
+}
+
+// Handle registers the route for the pattern. It panics if the pattern is
+// empty or already registered.
+func (m *ProxyMux) Handle(pattern string, route ProxyRoute) {
+	if pattern == "" {
+		panic("api_client: empty ProxyMux pattern")
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, r := range m.routes {
+		if r.pattern == pattern {
+			panic("api_client: multiple registrations for " + pattern)
+		}
+	}
+
+	opts := make([]proxy.Option, len(m.opts), len(m.opts)+len(route.Options))
+	copy(opts, m.opts)
+
+	m.routes = append(m.routes, muxRoute{
+		pattern: pattern,
+		route:   route,
+		opts:    append(opts, route.Options...),
+	})
+
+	// longest patterns first
+	sort.SliceStable(m.routes, func(i, j int) bool {
+		return len(m.routes[i].pattern) > len(m.routes[j].pattern)
+	})
+}
+
+func (m *ProxyMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	route, ok := m.match(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !routesMethod(route.route.Methods, r.Method) {
+		w.Header().Set("Allow", strings.Join(route.route.Methods, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	abortOnStreamError(m.client.ProxyAPI(route.route.Method, route.route.Path, r, w, route.route.RequestBodyType, route.opts...))
+}
+
+func (m *ProxyMux) match(p string) (muxRoute, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, r := range m.routes {
+		if p == r.pattern || strings.HasSuffix(r.pattern, "/") && strings.HasPrefix(p, r.pattern) {
+			return r, true
+		}
+	}
+
+	return muxRoute{}, false
+}
+
+func routesMethod(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+
+	for _, m := range methods {
+		if m == method || m == http.MethodGet && method == http.MethodHead {
+			return true
+		}
+	}
+
+	return false
+}
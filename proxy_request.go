@@ -0,0 +1,396 @@
+package api_client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func proxyPath(p string, httpReq *http.Request, opt *proxy.Options) (string, error) {
+	var u *url.URL
+
+	if p == "" {
+		u = &url.URL{
+			Path:     httpReq.URL.Path,
+			RawQuery: httpReq.URL.RawQuery,
+			Fragment: httpReq.URL.Fragment,
+		}
+
+		if opt.StripPathPrefix != "" {
+			stripped, ok := stripPathPrefix(u.Path, opt.StripPathPrefix)
+			if !ok {
+				return "", proxy.ErrPathNotFound
+			}
+			u.Path = stripped
+		}
+	} else if opt.PathPrefix != "" || len(opt.PathRewrites) > 0 || len(opt.QueryInterceptors) > 0 {
+		var err error
+		if u, err = url.Parse(p); err != nil {
+			return "", err
+		}
+	} else {
+		return p, nil
+	}
+
+	for _, rewrite := range opt.PathRewrites {
+		if rewritten, ok := rewrite.Rewrite(u.Path); ok {
+			u.Path = rewritten
+			u.RawPath = ""
+			break
+		}
+	}
+
+	if opt.PathPrefix != "" {
+		trailingSlash := strings.HasSuffix(u.Path, "/")
+
+		u.Path = path.Join("/", opt.PathPrefix, u.Path)
+		if trailingSlash && !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+	}
+
+	if len(opt.QueryInterceptors) > 0 {
+		query := u.Query()
+		for _, intcp := range opt.QueryInterceptors {
+			if query = intcp(query); query == nil {
+				query = make(url.Values)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// upstreamURL resolves the path against the base URL like the client does
+// with its own, so that the client base URL is overridden.
+func upstreamURL(base *url.URL, p string) (string, error) {
+	u, err := url.Parse(p)
+	if err != nil {
+		return "", err
+	}
+	if base == nil || u.Scheme != "" {
+		return p, nil
+	}
+
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.Path = path.Join(base.Path, u.Path)
+	u.RawPath = ""
+
+	return u.String(), nil
+}
+
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// normalizeMethod uppercases the method, and checks it's a known one, or a
+// valid token with custom methods allowed.
+func normalizeMethod(method string, opt *proxy.Options) (string, error) {
+	method = strings.ToUpper(method)
+
+	if knownMethods[method] {
+		return method, nil
+	}
+	if opt.AllowCustomMethods && method != "" && isToken(method) {
+		return method, nil
+	}
+
+	return "", fmt.Errorf("%w: %q", proxy.ErrInvalidMethod, method)
+}
+
+func isToken(s string) bool {
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("()<>@,;:\\\"/[]?={}", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func stripPathPrefix(p, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	if p == prefix {
+		return "/", true
+	}
+	if strings.HasPrefix(p, prefix+"/") {
+		return p[len(prefix):], true
+	}
+
+	return "", false
+}
+
+func parseRawRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
+	if !hasBody(req) {
+		return nil, "", nil
+	}
+
+	if opt.RequestJSONInterceptor != nil || opt.RequestKeyCase != proxy.CaseDirectionNone {
+		defer req.Body.Close()
+
+		buf, err := transformJSON(req.Body, opt.RequestJSONInterceptor, opt.RequestKeyCase, opt)
+		if err == io.EOF {
+			// empty body
+			return nil, "", nil
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		return buf, "application/json; charset=utf-8", nil
+	}
+
+	if opt.RequestXMLInterceptor != nil {
+		defer req.Body.Close()
+
+		buf := new(bytes.Buffer)
+		if err := interceptXML(req.Body, buf, opt.RequestXMLInterceptor); err != nil {
+			return nil, "", err
+		}
+
+		return buf, "application/xml; charset=utf-8", nil
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return req.Body, contentType, nil
+}
+
+func parseFormRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
+	if !hasBody(req) {
+		return nil, "", nil
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return nil, "", err
+	}
+
+	values := req.PostForm
+	if opt.RequestFormIncludeQuery {
+		values = req.Form
+	}
+
+	form := url.Values{}
+	for k, vv := range values {
+		for _, v := range vv {
+			form.Add(k, v)
+		}
+	}
+
+	if opt.RequestFormInterceptor != nil {
+		if newForm, err := opt.RequestFormInterceptor(form); err != nil {
+			return nil, "", err
+		} else {
+			form = newForm
+		}
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	return strings.NewReader(form.Encode()), contentType, nil
+}
+
+func parseMultipartFormRequest(req *http.Request, opt *proxy.Options) (io.Reader, string, error) {
+	if !hasBody(req) {
+		return nil, "", nil
+	}
+
+	if opt.MultipartStorageDir != "" || opt.MultipartInMemory {
+		return copyMultipartRequest(req, opt)
+	}
+
+	return streamMultipartRequest(req, opt)
+}
+
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
+
+var conditionalHeaders = []string{
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+}
+
+func forwardRequestHeaders(dst, src http.Header, opt *proxy.Options) {
+	var allowed map[string]bool
+	if opt.RequestHeaderAllowList != nil {
+		allowed = make(map[string]bool, len(opt.RequestHeaderAllowList)+len(conditionalHeaders))
+		for _, h := range opt.RequestHeaderAllowList {
+			allowed[http.CanonicalHeaderKey(h)] = true
+		}
+
+		if opt.ForwardConditionalHeaders {
+			for _, h := range conditionalHeaders {
+				allowed[h] = true
+			}
+		}
+	}
+
+	var hopByHop map[string]bool
+	if !opt.ForwardHopByHopHeaders {
+		hopByHop = hopByHopHeaders(src)
+	}
+
+	policy := opt.RequestHeaderPolicy
+
+	for k, vv := range src {
+		if allowed != nil && !allowed[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		if hopByHop[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+
+		if policy != nil {
+			if policy.Allow != nil && !headerNameMatchesAny(policy.Allow, k) &&
+				!(opt.ForwardConditionalHeaders && headerNameMatchesAny(conditionalHeaders, k)) {
+				continue
+			}
+			if headerNameMatchesAny(policy.Strip, k) {
+				continue
+			}
+			if to, ok := policy.Rename[http.CanonicalHeaderKey(k)]; ok {
+				k = to
+			}
+		}
+
+		for _, v := range vv {
+			dst.Add(k, v)
+		}
+	}
+
+	if hopByHop != nil {
+		// upgrades must reach the upstream, like trailers support
+		if upgrade := src.Get("Upgrade"); upgrade != "" && headerHasToken(src, "Connection", "upgrade") {
+			dst.Set("Connection", "Upgrade")
+			dst.Set("Upgrade", upgrade)
+		}
+		if headerHasToken(src, "Te", "trailers") {
+			dst.Set("Te", "trailers")
+		}
+	}
+}
+
+var hopByHopHeaderNames = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// hopByHopHeaders returns the standard hop-by-hop headers, and the ones
+// listed in the Connection header (RFC 7230, section 6.1).
+func hopByHopHeaders(h http.Header) map[string]bool {
+	headers := make(map[string]bool, len(hopByHopHeaderNames))
+	for _, name := range hopByHopHeaderNames {
+		headers[name] = true
+	}
+
+	for _, v := range h["Connection"] {
+		for _, token := range strings.Split(v, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				headers[http.CanonicalHeaderKey(token)] = true
+			}
+		}
+	}
+
+	return headers
+}
+
+// headerHasToken reports whether the comma-separated header contains the
+// token, case-insensitively.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, v := range h[key] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func addDefaultHeaders(dst http.Header, opt *proxy.Options) {
+	for k, vv := range opt.DefaultHeaders {
+		if _, ok := dst[k]; ok && !opt.DefaultHeadersOverride {
+			continue
+		}
+
+		dst[k] = append([]string(nil), vv...)
+	}
+}
+
+// setRequestBody replaces the body of the outgoing request, with its length
+// and GetBody set for the same body types as http.NewRequest.
+func setRequestBody(r *http.Request, body io.Reader) {
+	rc, ok := body.(io.ReadCloser)
+	if !ok {
+		rc = ioutil.NopCloser(body)
+	}
+
+	r.Body = rc
+	r.ContentLength = 0
+	r.GetBody = nil
+
+	switch v := body.(type) {
+	case *bytes.Buffer:
+		buf := v.Bytes()
+		r.ContentLength = int64(len(buf))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(buf)), nil
+		}
+	case *bytes.Reader:
+		snapshot := *v
+		r.ContentLength = int64(v.Len())
+		r.GetBody = func() (io.ReadCloser, error) {
+			rd := snapshot
+			return ioutil.NopCloser(&rd), nil
+		}
+	case *strings.Reader:
+		snapshot := *v
+		r.ContentLength = int64(v.Len())
+		r.GetBody = func() (io.ReadCloser, error) {
+			rd := snapshot
+			return ioutil.NopCloser(&rd), nil
+		}
+	}
+
+	if r.GetBody != nil && r.ContentLength == 0 {
+		r.Body = http.NoBody
+		r.GetBody = func() (io.ReadCloser, error) {
+			return http.NoBody, nil
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package api_client
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func newHeaderEchoUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for k := range r.Header {
+			if strings.HasPrefix(k, "X-") {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		w.Write([]byte(strings.Join(names, ",")))
+	}))
+}
+
+func TestRequestHeaderAllowList(t *testing.T) {
+	upstream := newHeaderEchoUpstream()
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		name string
+		opts []proxy.Option
+		want string
+	}{
+		{"default allow", nil, "X-Allowed,X-Other,X-Secret"},
+		{"allow list", []proxy.Option{proxy.WithRequestHeaderAllowList("x-allowed", "X-OTHER")}, "X-Allowed,X-Other"},
+		{"empty allow list", []proxy.Option{proxy.WithRequestHeaderAllowList()}, ""},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/headers", nil)
+		req.Header.Set("X-Allowed", "1")
+		req.Header.Set("X-Other", "1")
+		req.Header.Set("X-Secret", "1")
+
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, tc.opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: forwarded %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProxyBodylessRequest(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(strconv.Itoa(len(body)) + " " + r.Header.Get("Content-Type")))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	intercepted := false
+	opts := []proxy.Option{
+		proxy.WithRequestJSONInterceptor(func(v interface{}) (interface{}, error) {
+			intercepted = true
+			return v, nil
+		}),
+		proxy.WithRequestFormInterceptor(func(form url.Values) (url.Values, error) {
+			intercepted = true
+			return form, nil
+		}),
+		proxy.WithRequestMultipartFormInterceptor(func(w *multipart.Writer) error {
+			intercepted = true
+			return nil
+		}),
+	}
+
+	for _, bodyType := range []proxy.RequestBodyType{
+		proxy.RequestBodyTypeRaw,
+		proxy.RequestBodyTypeForm,
+		proxy.RequestBodyTypeMultipartForm,
+	} {
+		for _, body := range []io.ReadCloser{nil, http.NoBody} {
+			intercepted = false
+
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			req.Body = body
+
+			rec := httptest.NewRecorder()
+			if err := c.ProxyAPI("", "", req, rec, bodyType, opts...); err != nil {
+				t.Fatalf("%s: ProxyAPI: %v", bodyType, err)
+			}
+
+			if got := rec.Body.String(); got != "0 " {
+				t.Errorf("%s: upstream got %q, want no body and no Content-Type", bodyType, got)
+			}
+			if intercepted {
+				t.Errorf("%s: an interceptor ran without a body", bodyType)
+			}
+		}
+	}
+}
+
+func TestProxyFormWithQuery(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.URL.RawQuery + " " + string(body)))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		name string
+		opts []proxy.Option
+		seen string
+		want string
+	}{
+		{"body only", nil, "b=2", "q=1 b=2"},
+		{"with query", []proxy.Option{proxy.WithRequestFormIncludeQuery()}, "b=2&q=1", "q=1 b=2&q=1"},
+	} {
+		var seen string
+		opts := append([]proxy.Option{
+			proxy.WithRequestFormInterceptor(func(form url.Values) (url.Values, error) {
+				seen = form.Encode()
+				return form, nil
+			}),
+		}, tc.opts...)
+
+		req := httptest.NewRequest(http.MethodPost, "/submit?q=1", strings.NewReader("b=2"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeForm, opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+
+		if seen != tc.seen {
+			t.Errorf("%s: interceptor got %q, want %q", tc.name, seen, tc.seen)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: upstream got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProxyBodyForAnyMethod(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(r.Method + " " + string(body)))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, method := range []string{http.MethodDelete, http.MethodPatch} {
+		req := httptest.NewRequest(method, "/items/1", strings.NewReader(`{"id":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeRaw,
+			proxy.WithRequestJSONInterceptor(func(v interface{}) (interface{}, error) {
+				v.(map[string]interface{})["intercepted"] = true
+				return v, nil
+			}))
+		if err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", method, err)
+		}
+
+		if want := method + ` {"id":1,"intercepted":true}` + "\n"; rec.Body.String() != want {
+			t.Errorf("%s: upstream got %q, want %q", method, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestProxyDefaultHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Join([]string{
+			r.Header.Get("X-Gateway-Version"),
+			r.Header.Get("X-Static"),
+			r.Header.Get("X-Client"),
+			r.Host,
+		}, ",")))
+	}))
+	defer upstream.Close()
+
+	upstreamHost := strings.TrimPrefix(upstream.URL, "http://")
+	c := NewClient(
+		WithBaseURL(upstream.URL),
+		WithDefaultHeaders(http.Header{"X-Client": {"client"}, "X-Static": {"client"}}),
+	)
+
+	defaults := http.Header{
+		"X-Gateway-Version": {"2"},
+		"X-Static":          {"default"},
+		"Host":              {"ignored.example"},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		override bool
+		want     string
+	}{
+		{"merge", false, "1,default,client," + upstreamHost},
+		{"override", true, "2,default,client," + upstreamHost},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/x", nil)
+		req.Header.Set("X-Gateway-Version", "1")
+
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, proxy.WithDefaultHeaders(defaults, tc.override)); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: upstream got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProxyChunkedRequestBody(t *testing.T) {
+	type received struct {
+		contentLength    int64
+		transferEncoding []string
+		body             []byte
+	}
+	got := make(chan received, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("upstream read: %v", err)
+		}
+		got <- received{r.ContentLength, r.TransferEncoding, body}
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.TransparentProxyAPI(r, w, proxy.RequestBodyTypeRaw); err != nil {
+			t.Errorf("TransparentProxyAPI: %v", err)
+		}
+	}))
+	defer frontend.Close()
+
+	want := []byte(strings.Repeat(`{"chunk":"0123456789abcdef"}`, 64<<10))
+	pr, pw := io.Pipe()
+	go func() {
+		for b := want; len(b) > 0; {
+			n := 4096
+			if n > len(b) {
+				n = len(b)
+			}
+			pw.Write(b[:n])
+			b = b[n:]
+		}
+		pw.Close()
+	}()
+
+	res, err := http.Post(frontend.URL+"/upload", "application/json", pr)
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	res.Body.Close()
+
+	r := <-got
+	if r.contentLength != -1 || len(r.transferEncoding) != 1 || r.transferEncoding[0] != "chunked" {
+		t.Errorf("upstream got Content-Length %d, Transfer-Encoding %v, want chunked", r.contentLength, r.transferEncoding)
+	}
+	if !bytes.Equal(r.body, want) {
+		t.Errorf("upstream got %d bytes, want the %d sent", len(r.body), len(want))
+	}
+}
+
+func TestProxyHopByHopHeaders(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for k := range r.Header {
+			if strings.HasPrefix(k, "X-") || k == "Keep-Alive" || k == "Proxy-Authorization" {
+				names = append(names, k)
+			}
+		}
+		sort.Strings(names)
+		w.Write([]byte(strings.Join(names, ",") + " " + r.UserAgent()))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		name string
+		opts []proxy.Option
+		want string
+	}{
+		{"filtered", nil, "X-Kept client/1.0"},
+		{"user agent", []proxy.Option{proxy.WithUserAgent("gateway/2.0")}, "X-Kept gateway/2.0"},
+		{"unfiltered", []proxy.Option{proxy.WithoutHopByHopFiltering()}, "Keep-Alive,Proxy-Authorization,X-Hop,X-Kept client/1.0"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/headers", nil)
+		req.Header.Set("Connection", "keep-alive, X-Hop")
+		req.Header.Set("Keep-Alive", "timeout=5")
+		req.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+		req.Header.Set("X-Hop", "1")
+		req.Header.Set("X-Kept", "1")
+		req.Header.Set("User-Agent", "client/1.0")
+
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, tc.opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: upstream got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestProxyMethodNormalization(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(r.Method))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		method   string
+		incoming string
+		opts     []proxy.Option
+		want     string
+	}{
+		{"get", http.MethodPost, nil, "GET"},
+		{"", "patch", nil, "PATCH"},
+		{"FOOBAR", http.MethodGet, nil, ""},
+		{"", "purge", nil, ""},
+		{"", "purge", []proxy.Option{proxy.WithCustomMethods()}, "PURGE"},
+		{"FOO BAR", http.MethodGet, []proxy.Option{proxy.WithCustomMethods()}, ""},
+	} {
+		atomic.StoreInt32(&hits, 0)
+
+		rec := httptest.NewRecorder()
+		err := c.ProxyAPI(tc.method, "", httptest.NewRequest(tc.incoming, "/x", nil), rec, proxy.RequestBodyTypeNone, tc.opts...)
+
+		if tc.want == "" {
+			if !errors.Is(err, proxy.ErrInvalidMethod) {
+				t.Errorf("%q from %q: err = %v, want ErrInvalidMethod", tc.method, tc.incoming, err)
+			}
+			if rec.Code != http.StatusBadRequest || atomic.LoadInt32(&hits) != 0 {
+				t.Errorf("%q from %q: got %d after %d upstream requests, want a 400 before any", tc.method, tc.incoming, rec.Code, hits)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q from %q: ProxyAPI: %v", tc.method, tc.incoming, err)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%q from %q: upstream method = %q, want %q", tc.method, tc.incoming, got, tc.want)
+		}
+	}
+}
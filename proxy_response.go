@@ -0,0 +1,753 @@
+package api_client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/operaads/api-client/interceptor"
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/response"
+)
+
+var notModifiedHeaders = []string{
+	"Cache-Control",
+	"Content-Location",
+	"Etag",
+	"Expires",
+	"Last-Modified",
+	"Vary",
+}
+
+func writeProxyResponse(
+	httpReq *http.Request,
+	res *response.APIResponse,
+	resWriter http.ResponseWriter,
+	opt *proxy.Options,
+	result *proxy.Result,
+) error {
+	defer res.Body.Close()
+
+	for _, intcp := range opt.ResponseInterceptors {
+		intercepted, err := intcp(res.Response)
+		if err != nil {
+			return err
+		}
+
+		if intercepted.Body != res.Body {
+			defer intercepted.Body.Close()
+		}
+		res = &response.APIResponse{Response: intercepted}
+	}
+
+	result.StatusCode = res.StatusCode
+
+	resHeaders := make(http.Header)
+
+	// transfer response headers
+	headerBytes := 0
+	for _, h := range transferredHeaderNames(res.Header, opt) {
+		if vv, ok := res.Header[h]; ok {
+			if opt.MaxResponseHeaderBytes > 0 {
+				if headerBytes += headerSize(h, vv); headerBytes > opt.MaxResponseHeaderBytes {
+					opt.Notify(proxy.Event{
+						Type:    proxy.EventTypeResponseHeadersTooLarge,
+						Request: httpReq,
+						Err:     proxy.ErrResponseHeadersTooLarge,
+					})
+
+					if opt.FailOnLargeResponseHeaders {
+						return proxy.ErrResponseHeadersTooLarge
+					}
+					break
+				}
+			}
+
+			headerValue := make([]string, len(vv))
+			copy(headerValue, vv)
+			resHeaders[h] = headerValue
+		}
+	}
+
+	// redirects are meaningless without their location
+	if res.StatusCode >= 300 && res.StatusCode < 400 {
+		if loc := res.Header.Get("Location"); loc != "" {
+			resHeaders.Set("Location", loc)
+		}
+
+		if opt.LocationRewriter != nil {
+			rewriteLocationHeader(resHeaders, "Location", opt.LocationRewriter)
+			rewriteLocationHeader(resHeaders, "Content-Location", opt.LocationRewriter)
+		}
+	}
+
+	// responses without body skip interceptors and body copy
+	if isHeadResponse(res) || res.StatusCode == http.StatusNoContent || res.StatusCode == http.StatusNotModified {
+		if isHeadResponse(res) {
+			resHeaders.Set("Content-Type", res.Header.Get("Content-Type"))
+			if res.ContentLength >= 0 {
+				resHeaders.Set("Content-Length", strconv.FormatInt(res.ContentLength, 10))
+			}
+		}
+
+		// the client needs them to revalidate its cached copy
+		if res.StatusCode == http.StatusNotModified {
+			for _, h := range notModifiedHeaders {
+				if vv, ok := res.Header[h]; ok {
+					resHeaders[h] = append([]string(nil), vv...)
+				}
+			}
+		}
+
+		status := res.StatusCode
+		if opt.ResponseStatusInterceptor != nil {
+			status = interceptResponseStatus(status, resHeaders, opt.ResponseStatusInterceptor)
+		}
+
+		writeHeaders(resWriter.Header(), resHeaders)
+
+		resWriter.WriteHeader(status)
+
+		return nil
+	}
+
+	// set below to describe the body actually written
+	resHeaders.Del("Content-Length")
+	resHeaders.Del("Content-Encoding")
+
+	var resBody io.Reader
+
+	resContentEncoding := res.Header.Get("Content-Encoding")
+	resContentType := res.Header.Get("Content-Type")
+
+	var resStreaming bool
+
+	status := res.StatusCode
+
+	if body, ok := opt.StandardErrorBodies[res.StatusCode]; ok && (res.StatusCode < 200 || res.StatusCode > 299) {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+
+		opt.Notify(proxy.Event{
+			Type:    proxy.EventTypeErrorBodyReplaced,
+			Request: httpReq,
+		})
+
+		resHeaders.Set("Content-Type", "application/json; charset=utf-8")
+		resHeaders.Set("Content-Length", strconv.Itoa(buf.Len()))
+
+		resBody = buf
+	} else if opt.ErrorResponseInterceptor != nil && (res.StatusCode < 200 || res.StatusCode > 299) {
+		reader, err := interceptedResponseBody(res.Body, resContentEncoding, opt)
+		if err != nil {
+			return err
+		}
+
+		buf, newStatus, err := interceptErrorResponse(reader, res.StatusCode, opt)
+		if err != nil {
+			return err
+		}
+
+		resHeaders.Set("Content-Type", "application/json; charset=utf-8")
+		resHeaders.Set("Content-Length", strconv.Itoa(buf.Len()))
+
+		resBody = buf
+		status = newStatus
+		result.JSONIntercepted = true
+	} else if opt.ResponseJSONStreamInterceptor != nil && matchesContentType(resContentType, isJSONMediaType) {
+		reader, err := interceptedResponseBody(res.Body, resContentEncoding, opt)
+		if err != nil {
+			return err
+		}
+
+		pr, pw := io.Pipe()
+		defer pr.Close()
+
+		go func() {
+			pw.CloseWithError(opt.ResponseJSONStreamInterceptor(json.NewDecoder(reader), json.NewEncoder(pw)))
+		}()
+
+		resHeaders.Set("Content-Type", "application/json; charset=utf-8")
+
+		resBody = pr
+		resStreaming = true
+		result.JSONIntercepted = true
+	} else if opt.ResponseJSONArrayInterceptor != nil && matchesContentType(resContentType, isJSONMediaType) {
+		reader, err := interceptedResponseBody(res.Body, resContentEncoding, opt)
+		if err != nil {
+			return err
+		}
+
+		pr, pw := io.Pipe()
+		defer pr.Close()
+
+		go func() {
+			pw.CloseWithError(streamJSONArray(reader, pw, opt))
+		}()
+
+		resHeaders.Set("Content-Type", "application/json; charset=utf-8")
+
+		resBody = pr
+		resStreaming = true
+		result.JSONIntercepted = true
+	} else if opt.ResponseCSVInterceptor != nil && matchesContentType(resContentType, isCSVMediaType) {
+		reader, err := interceptedResponseBody(res.Body, resContentEncoding, opt)
+		if err != nil {
+			return err
+		}
+
+		pr, pw := io.Pipe()
+		defer pr.Close()
+
+		go func() {
+			pw.CloseWithError(streamCSV(reader, pw, opt.ResponseCSVInterceptor))
+		}()
+
+		contentType := resContentType
+		if contentType == "" {
+			contentType = "text/csv; charset=utf-8"
+		}
+		resHeaders.Set("Content-Type", contentType)
+
+		resBody = pr
+		resStreaming = true
+	} else if (opt.ResponseJSONInterceptor != nil || opt.ResponseKeyCase != proxy.CaseDirectionNone) &&
+		matchesContentType(resContentType, isJSONMediaType) {
+		reader, err := interceptedResponseBody(res.Body, resContentEncoding, opt)
+		if err != nil {
+			return err
+		}
+
+		buf, err := transformJSON(reader, opt.ResponseJSONInterceptor, opt.ResponseKeyCase, opt)
+		if err != nil {
+			return err
+		}
+
+		resHeaders.Set("Content-Type", "application/json; charset=utf-8")
+		resHeaders.Set("Content-Length", strconv.Itoa(buf.Len()))
+
+		resBody = buf
+		result.JSONIntercepted = true
+	} else if opt.ResponseXMLInterceptor != nil && matchesContentType(resContentType, isXMLMediaType) {
+		reader, err := interceptedResponseBody(res.Body, resContentEncoding, opt)
+		if err != nil {
+			return err
+		}
+
+		buf := new(bytes.Buffer)
+		if err := interceptXML(reader, buf, opt.ResponseXMLInterceptor); err != nil {
+			return err
+		}
+
+		resHeaders.Set("Content-Type", "application/xml; charset=utf-8")
+		resHeaders.Set("Content-Length", strconv.Itoa(buf.Len()))
+
+		resBody = buf
+	} else if opt.HonorAcceptEncoding && isDecodableEncoding(resContentEncoding) &&
+		!acceptsEncoding(httpReq, resContentEncoding) {
+		reader, err := decodeResponseBody(res.Body, resContentEncoding)
+		if err != nil {
+			return err
+		}
+
+		resHeaders.Set("Content-Type", resContentType)
+
+		resBody = reader
+	} else {
+		resHeaders.Set("Content-Type", resContentType)
+
+		if res.ContentLength >= 0 {
+			resHeaders.Set("Content-Length", strconv.FormatInt(res.ContentLength, 10))
+		}
+		if resContentEncoding != "" {
+			resHeaders.Set("Content-Encoding", resContentEncoding)
+		}
+
+		resBody = res.Body
+	}
+
+	if contentEncoding := resHeaders.Get("Content-Encoding"); opt.ResponseBodyTransformer != nil &&
+		transformsMediaType(resHeaders.Get("Content-Type"), opt.ResponseBodyTransformTypes) &&
+		(contentEncoding == "" || isDecodableEncoding(contentEncoding)) {
+		if contentEncoding != "" {
+			reader, err := interceptedResponseBody(resBody, contentEncoding, opt)
+			if err != nil {
+				return err
+			}
+
+			resBody = reader
+			resHeaders.Del("Content-Encoding")
+		}
+
+		resBody = opt.ResponseBodyTransformer(resBody)
+		resHeaders.Del("Content-Length")
+		resStreaming = true
+	}
+
+	coding := responseEncoding(httpReq, resContentEncoding, resHeaders, opt)
+	if coding != "" && !resStreaming {
+		if n, err := strconv.ParseInt(resHeaders.Get("Content-Length"), 10, 64); err == nil {
+			minSize := opt.CompressMinSize
+			if minSize <= 0 {
+				minSize = defaultCompressMinSize
+			}
+
+			if n < minSize {
+				coding = ""
+			}
+		}
+	}
+	if coding != "" {
+		resHeaders.Del("Content-Length")
+		resHeaders.Set("Content-Encoding", coding)
+		resHeaders.Add("Vary", "Accept-Encoding")
+	}
+
+	if opt.ResponseStatusInterceptor != nil {
+		status = interceptResponseStatus(status, resHeaders, opt.ResponseStatusInterceptor)
+
+		// the interceptor dropped the body
+		if !bodyAllowedForStatus(status) || resHeaders.Get("Content-Length") == "0" {
+			resHeaders.Del("Content-Encoding")
+			if bodyAllowedForStatus(status) {
+				resHeaders.Set("Content-Length", "0")
+			} else {
+				resHeaders.Del("Content-Length")
+			}
+
+			writeHeaders(resWriter.Header(), resHeaders)
+			resWriter.WriteHeader(status)
+
+			return nil
+		}
+	}
+
+	writeHeaders(resWriter.Header(), resHeaders)
+
+	// announce trailers, their values are known after the body is read
+	if len(res.Trailer) > 0 {
+		trailerNames := make([]string, 0, len(res.Trailer))
+		for k := range res.Trailer {
+			trailerNames = append(trailerNames, k)
+		}
+		sort.Strings(trailerNames)
+
+		resWriter.Header()["Trailer"] = trailerNames
+	}
+
+	// write status code
+	resWriter.WriteHeader(status)
+
+	// copy response
+	counter := &countingWriter{Writer: resWriter}
+	var w io.Writer = counter
+
+	var encWriter encodingWriter
+	if coding != "" {
+		encWriter = newEncodingWriter(w, coding)
+		w = encWriter
+	}
+
+	if flusher, ok := resWriter.(http.Flusher); ok && resStreaming {
+		w = &flushWriter{Writer: w, flush: func() {
+			if encWriter != nil {
+				encWriter.Flush()
+			}
+			flusher.Flush()
+		}}
+	}
+
+	_, err := copyBuffer(w, resBody, opt.CopyBufferSize)
+	if err == nil && encWriter != nil {
+		err = encWriter.Close()
+	}
+	result.BytesWritten = counter.n
+	if err != nil {
+		streamErr := &proxy.StreamError{BytesWritten: counter.n, Err: err}
+
+		opt.Notify(proxy.Event{
+			Type:    proxy.EventTypeStreamError,
+			Request: httpReq,
+			Err:     streamErr,
+		})
+
+		return streamErr
+	}
+
+	for k, vv := range res.Trailer {
+		resWriter.Header()[k] = vv
+	}
+
+	return nil
+}
+
+func writeCannedResponse(
+	httpReq *http.Request,
+	canned *proxy.CannedResponse,
+	resWriter http.ResponseWriter,
+	result *proxy.Result,
+) error {
+	status := canned.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	result.StatusCode = status
+	result.ShortCircuited = true
+
+	writeHeaders(resWriter.Header(), canned.Header.Clone())
+	resWriter.Header().Set("Content-Length", strconv.Itoa(len(canned.Body)))
+
+	resWriter.WriteHeader(status)
+
+	if httpReq.Method == http.MethodHead {
+		return nil
+	}
+
+	n, err := resWriter.Write(canned.Body)
+	result.BytesWritten = int64(n)
+
+	return err
+}
+
+// canonicalHeaderNames returns the canonical header names, without duplicates,
+// in the given order.
+func canonicalHeaderNames(names []string) []string {
+	canonical := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+
+	for _, name := range names {
+		name = http.CanonicalHeaderKey(name)
+		if !seen[name] {
+			seen[name] = true
+			canonical = append(canonical, name)
+		}
+	}
+
+	return canonical
+}
+
+// transferredHeaderNames returns the names of the response headers matching
+// the transferred ones, or all of them, without the denied and hop-by-hop
+// ones. Wildcard matches are sorted, so that the order is stable.
+func transferredHeaderNames(h http.Header, opt *proxy.Options) []string {
+	var candidates []string
+	if opt.TransferAllResponseHeaders {
+		for name := range h {
+			candidates = append(candidates, name)
+		}
+		sort.Strings(candidates)
+	} else {
+		for _, pattern := range canonicalHeaderNames(opt.TransferResponseHeaders) {
+			if !strings.HasSuffix(pattern, "*") {
+				candidates = append(candidates, pattern)
+				continue
+			}
+
+			var matched []string
+			for name := range h {
+				if headerNameMatches(pattern, name) {
+					matched = append(matched, name)
+				}
+			}
+			sort.Strings(matched)
+			candidates = append(candidates, matched...)
+		}
+	}
+
+	hopByHop := hopByHopHeaders(h)
+	seen := make(map[string]bool, len(candidates))
+
+	names := candidates[:0]
+	for _, name := range candidates {
+		if seen[name] || hopByHop[http.CanonicalHeaderKey(name)] || headerNameMatchesAny(opt.ResponseHeaderDenyList, name) {
+			continue
+		}
+
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// headerNameMatches reports whether the header name matches the pattern,
+// case-insensitively. A pattern ending with "*" matches names with its prefix.
+func headerNameMatches(pattern, name string) bool {
+	if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+		return len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix)
+	}
+
+	return strings.EqualFold(pattern, name)
+}
+
+// transformsMediaType reports whether the body transformer applies to the
+// content type, matched like header names.
+func transformsMediaType(contentType string, patterns []string) bool {
+	return len(patterns) == 0 || headerNameMatchesAny(patterns, mediaType(contentType))
+}
+
+func headerNameMatchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if headerNameMatches(pattern, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headerSize returns the size of the header lines on the wire.
+func headerSize(key string, values []string) int {
+	n := 0
+	for _, v := range values {
+		n += len(key) + len(": ") + len(v) + len("\r\n")
+	}
+
+	return n
+}
+
+// writeHeaders sets the headers of the response. Set-Cookie values are added
+// to the ones already set, e.g. by a middleware, since each is a separate
+// cookie.
+func writeHeaders(dst, src http.Header) {
+	for k, vv := range src {
+		if k == "Set-Cookie" {
+			for _, v := range vv {
+				dst.Add(k, v)
+			}
+			continue
+		}
+
+		dst[k] = vv
+	}
+}
+
+// rewriteLocationHeader rewrites the header if it's set to a valid URL.
+func rewriteLocationHeader(h http.Header, key string, rewrite func(string) string) {
+	loc := h.Get(key)
+	if loc == "" {
+		return
+	}
+	if _, err := url.Parse(loc); err != nil {
+		return
+	}
+
+	h.Set(key, rewrite(loc))
+}
+
+// interceptErrorResponse decodes the error body as JSON, or passes it as
+// string if it isn't JSON, or nil if it's empty.
+func interceptErrorResponse(r io.Reader, status int, opt *proxy.Options) (*bytes.Buffer, int, error) {
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var obj interface{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		if opt.JSONUseNumber {
+			decoder.UseNumber()
+		}
+
+		if err := decoder.Decode(&obj); err != nil {
+			obj = string(body)
+		}
+	}
+
+	newStatus, newObj := opt.ErrorResponseInterceptor(status, obj)
+	if newStatus == 0 {
+		newStatus = status
+	}
+
+	buf := new(bytes.Buffer)
+	if err := json.NewEncoder(buf).Encode(newObj); err != nil {
+		return nil, 0, err
+	}
+
+	return buf, newStatus, nil
+}
+
+func isHeadResponse(res *response.APIResponse) bool {
+	return res.Request != nil && res.Request.Method == http.MethodHead
+}
+
+func upstreamError(httpReq *http.Request, err error, opt *proxy.Options) error {
+	// the client went away, the upstreams aren't to blame
+	if httpReq.Context().Err() != nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var exhaustedErr *proxy.ExhaustedError
+
+	if errors.As(err, &exhaustedErr) {
+		// retried attempts
+	} else if urlErr, ok := err.(*url.Error); ok {
+		exhaustedErr = &proxy.ExhaustedError{
+			Attempts: []proxy.Attempt{{Upstream: urlErr.URL, Err: urlErr}},
+		}
+	} else {
+		// the request was never sent
+		return err
+	}
+
+	exhaustedErr.Status = opt.ExhaustionStatus
+	exhaustedErr.RetryAfter = opt.ExhaustionRetryAfter
+
+	opt.Notify(proxy.Event{
+		Type:    proxy.EventTypeUpstreamsExhausted,
+		Request: httpReq,
+		Err:     exhaustedErr,
+	})
+
+	return exhaustedErr
+}
+
+// rejectedRequestErrors are the errors of requests rejected before reaching
+// the upstream.
+var rejectedRequestErrors = []error{
+	proxy.ErrPathNotFound,
+	proxy.ErrInvalidMethod,
+	proxy.ErrInvalidGraphQLRequest,
+	proxy.ErrRequestTooLarge,
+}
+
+// writeProxyError writes the response of a request that couldn't be proxied:
+// the built-in response of the error if it has one, or the one of the error
+// handler.
+func writeProxyError(resWriter http.ResponseWriter, httpReq *http.Request, err error, opt *proxy.Options) {
+	if errors.Is(err, ErrRateLimited) {
+		http.Error(resWriter, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	if _, ok := err.(*proxy.ExhaustedError); ok && opt.ExhaustionStatus != 0 {
+		writeExhaustionResponse(resWriter, opt)
+		return
+	}
+	if err == proxy.ErrConcurrencyLimitExceeded {
+		http.Error(resWriter, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	if err == proxy.ErrTotalDeadlineExceeded {
+		http.Error(resWriter, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+		return
+	}
+
+	if opt.ErrorHandler != nil {
+		opt.ErrorHandler(resWriter, httpReq, err)
+		return
+	}
+
+	for _, rejected := range rejectedRequestErrors {
+		if errors.Is(err, rejected) {
+			status := proxy.ErrorStatus(err)
+			http.Error(resWriter, http.StatusText(status), status)
+			return
+		}
+	}
+}
+
+func writeExhaustionResponse(resWriter http.ResponseWriter, opt *proxy.Options) {
+	if opt.ExhaustionStatus == 0 {
+		return
+	}
+
+	if opt.ExhaustionRetryAfter > 0 {
+		retryAfter := int64((opt.ExhaustionRetryAfter + time.Second - 1) / time.Second)
+		resWriter.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+
+	http.Error(resWriter, http.StatusText(opt.ExhaustionStatus), opt.ExhaustionStatus)
+}
+
+func interceptedResponseBody(body io.Reader, contentEncoding string, opt *proxy.Options) (io.Reader, error) {
+	reader, err := decodeResponseBody(body, contentEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.MaxResponseBytes > 0 {
+		reader = &maxBytesReader{r: reader, n: opt.MaxResponseBytes}
+	}
+
+	return reader, nil
+}
+
+func isDecodableEncoding(contentEncoding string) bool {
+	switch normalizeEncoding(contentEncoding) {
+	case "gzip", "x-gzip", "deflate", "br", "zstd":
+		return true
+	default:
+		return false
+	}
+}
+
+// decodeResponseBody decodes the body with the content coding. Unknown
+// codings are left as is.
+func decodeResponseBody(body io.Reader, contentEncoding string) (io.Reader, error) {
+	switch normalizeEncoding(contentEncoding) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	case "br":
+		return brotli.NewReader(body), nil
+	case "zstd":
+		dec, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return &zstdReader{dec: dec}, nil
+	default:
+		return body, nil
+	}
+}
+
+func normalizeEncoding(contentEncoding string) string {
+	return strings.ToLower(strings.TrimSpace(contentEncoding))
+}
+
+// zstdReader releases the decoder once the body is read.
+type zstdReader struct {
+	dec *zstd.Decoder
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	n, err := r.dec.Read(p)
+	if err != nil {
+		r.dec.Close()
+	}
+
+	return n, err
+}
+
+// interceptResponseStatus returns the status returned by the interceptor, or
+// the given one if it returned 0.
+func interceptResponseStatus(status int, header http.Header, intcp interceptor.ResponseStatusInterceptor) int {
+	if newStatus := intcp(status, header); newStatus != 0 {
+		return newStatus
+	}
+
+	return status
+}
+
+func bodyAllowedForStatus(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
@@ -0,0 +1,257 @@
+package api_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func TestExhaustionResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	host := upstream.Listener.Addr().String()
+	upstream.Close()
+
+	c := NewClient(WithBaseURL("http://" + host))
+
+	var events []proxy.Event
+	opts := []proxy.Option{
+		proxy.WithHostPolicy(map[string]proxy.HostPolicy{
+			host: {Retries: 2, RetryBackoff: time.Millisecond, RetryMaxBackoff: time.Millisecond},
+		}),
+		proxy.WithExhaustionResponse(http.StatusServiceUnavailable, 1500*time.Millisecond),
+		proxy.WithObserver(func(e proxy.Event) {
+			events = append(events, e)
+		}),
+	}
+
+	rec := httptest.NewRecorder()
+	err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/x", nil), rec, proxy.RequestBodyTypeNone, opts...)
+
+	var exhaustedErr *proxy.ExhaustedError
+	if !errors.As(err, &exhaustedErr) {
+		t.Fatalf("err = %v, want an ExhaustedError", err)
+	}
+	if len(exhaustedErr.Attempts) != 3 {
+		t.Errorf("attempts = %d, want 3", len(exhaustedErr.Attempts))
+	}
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2", got)
+	}
+
+	if len(events) != 1 || events[0].Type != proxy.EventTypeUpstreamsExhausted || events[0].Err != exhaustedErr {
+		t.Errorf("events = %+v, want one UPSTREAMS_EXHAUSTED event with the error", events)
+	}
+}
+
+func TestProxyBodylessResponses(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Length", "7")
+			w.Write([]byte(`{"a":1}`))
+		}
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		method        string
+		path          string
+		status        int
+		contentLength string
+	}{
+		{http.MethodHead, "/doc", http.StatusOK, "7"},
+		{http.MethodGet, "/not-modified", http.StatusNotModified, ""},
+		{http.MethodGet, "/no-content", http.StatusNoContent, ""},
+	} {
+		intercepted := false
+		rec := httptest.NewRecorder()
+
+		err := c.ProxyAPI("", "", httptest.NewRequest(tc.method, tc.path, nil), rec, proxy.RequestBodyTypeNone,
+			proxy.WithResponseJSONInterceptor(func(v interface{}) (interface{}, error) {
+				intercepted = true
+				return v, nil
+			}))
+		if err != nil {
+			t.Fatalf("%s %s: ProxyAPI: %v", tc.method, tc.path, err)
+		}
+
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: status = %d, want %d", tc.method, tc.path, rec.Code, tc.status)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("%s %s: body = %q, want none", tc.method, tc.path, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Length"); got != tc.contentLength {
+			t.Errorf("%s %s: Content-Length = %q, want %q", tc.method, tc.path, got, tc.contentLength)
+		}
+		if intercepted {
+			t.Errorf("%s %s: the JSON interceptor ran", tc.method, tc.path)
+		}
+	}
+}
+
+func TestInterceptedContentLength(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := gzipBytes(t, []byte(`{"a":1}`))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone,
+		proxy.WithTransferResponseHeaders("Content-Length", "Content-Encoding"),
+		proxy.WithResponseJSONInterceptor(func(v interface{}) (interface{}, error) {
+			v.(map[string]interface{})["added"] = "a longer body"
+			return v, nil
+		}))
+	if err != nil {
+		t.Fatalf("ProxyAPI: %v", err)
+	}
+
+	if got, want := rec.Header().Get("Content-Length"), strconv.Itoa(rec.Body.Len()); got != want {
+		t.Errorf("Content-Length = %s, want %s", got, want)
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none", got)
+	}
+	if want := `{"a":1,"added":"a longer body"}` + "\n"; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestProxySetCookies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Set-Cookie", "a=1; Path=/")
+		w.Header().Add("Set-Cookie", "b=2; HttpOnly")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	passThrough := func(v interface{}) (interface{}, error) { return v, nil }
+
+	for _, tc := range []struct {
+		name string
+		opts []proxy.Option
+	}{
+		{"raw", nil},
+		{"json interceptor", []proxy.Option{proxy.WithResponseJSONInterceptor(passThrough)}},
+	} {
+		opts := append([]proxy.Option{proxy.WithTransferResponseHeaders("Set-Cookie")}, tc.opts...)
+
+		rec := httptest.NewRecorder()
+		// set by a middleware before proxying
+		rec.Header().Set("Set-Cookie", "session=s")
+		if err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/x", nil), rec, proxy.RequestBodyTypeNone, opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+
+		got := rec.Result().Header.Values("Set-Cookie")
+		if len(got) != 3 || got[0] != "session=s" || got[1] != "a=1; Path=/" || got[2] != "b=2; HttpOnly" {
+			t.Errorf("%s: Set-Cookie = %q, want the middleware and both upstream cookies", tc.name, got)
+		}
+	}
+}
+
+func TestTransferredHeadersDeduplicated(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Multi", "a")
+		w.Header().Add("X-Multi", "b")
+		w.Header().Set("X-Other", "1")
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, transferred := range [][]string{
+		{"X-Multi", "x-multi"},
+		{"x-MULTI", "X-*", "X-Multi"},
+	} {
+		rec := proxyGet(t, c, "/x", nil, proxy.WithTransferResponseHeaders(transferred...))
+
+		if got := rec.Result().Header.Values("X-Multi"); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+			t.Errorf("%q: X-Multi = %q, want [a b]", transferred, got)
+		}
+	}
+}
+
+func TestTransferredHeaderNamesOrder(t *testing.T) {
+	h := http.Header{"X-B": {"1"}, "X-A": {"1"}, "X-C": {"1"}, "Etag": {"1"}}
+	opt := &proxy.Options{}
+	proxy.WithTransferResponseHeaders("etag", "X-*", "ETag", "X-A")(opt)
+
+	for i := 0; i < 10; i++ {
+		if got := transferredHeaderNames(h, opt); !reflect.DeepEqual(got, []string{"Etag", "X-A", "X-B", "X-C"}) {
+			t.Fatalf("transferredHeaderNames = %q, want [Etag X-A X-B X-C]", got)
+		}
+	}
+}
+
+func TestClientCancellationNotExhaustion(t *testing.T) {
+	started := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	var events []proxy.Event
+	opts := []proxy.Option{
+		proxy.WithExhaustionResponse(http.StatusServiceUnavailable, time.Second),
+		proxy.WithObserver(func(e proxy.Event) {
+			events = append(events, e)
+		}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/x", nil).WithContext(ctx)
+	err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, opts...)
+
+	var exhaustedErr *proxy.ExhaustedError
+	if !errors.Is(err, context.Canceled) || errors.As(err, &exhaustedErr) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if rec.Code == http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "" {
+		t.Errorf("got the exhaustion response %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	for _, e := range events {
+		if e.Type == proxy.EventTypeUpstreamsExhausted {
+			t.Errorf("got an UPSTREAMS_EXHAUSTED event: %v", e.Err)
+		}
+	}
+}
@@ -0,0 +1,527 @@
+package api_client
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func newEchoUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.RequestURI() + " " + strings.Join(r.Header["X-Trace"], ",")))
+	}))
+}
+
+func TestProxyInterceptorChain(t *testing.T) {
+	upstream := newEchoUpstream()
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	urlStep := func(step string) func(*url.URL) {
+		return func(u *url.URL) {
+			u.Path += "/" + step
+		}
+	}
+	reqStep := func(step string) func(*http.Request) {
+		return func(r *http.Request) {
+			r.Header.Add("X-Trace", step)
+		}
+	}
+
+	deprecated := func(o *proxy.Options) {
+		o.URLInterceptor = urlStep("legacy")
+		o.RequestInterceptor = reqStep("legacy")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		opts  []proxy.Option
+		path  string
+		trace string
+	}{
+		{
+			"append",
+			[]proxy.Option{
+				proxy.AppendURLInterceptor(urlStep("a")),
+				proxy.AppendURLInterceptor(urlStep("b"), urlStep("c")),
+				proxy.AppendRequestInterceptor(reqStep("a")),
+				proxy.AppendRequestInterceptor(reqStep("b")),
+			},
+			"/x/a/b/c", "a,b",
+		},
+		{
+			"replace",
+			[]proxy.Option{
+				proxy.AppendURLInterceptor(urlStep("a")),
+				proxy.WithURLInterceptor(urlStep("b")),
+				proxy.AppendRequestInterceptor(reqStep("a")),
+				proxy.WithRequestInterceptor(reqStep("b")),
+			},
+			"/x/b", "b",
+		},
+		{
+			"deprecated fields first",
+			[]proxy.Option{
+				proxy.AppendURLInterceptor(urlStep("a")),
+				proxy.AppendRequestInterceptor(reqStep("a")),
+				deprecated,
+			},
+			"/x/legacy/a", "legacy,a",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := proxyGet(t, c, "/x", nil, tc.opts...)
+
+			if got, want := rec.Body.String(), tc.path+" "+tc.trace; got != want {
+				t.Errorf("upstream path and interceptors = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func newConditionalUpstream() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"v":1}`))
+	}))
+}
+
+func TestProxyConditionalRequest(t *testing.T) {
+	upstream := newConditionalUpstream()
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		name   string
+		etag   string
+		status int
+		body   string
+	}{
+		{"hit", `"v1"`, http.StatusNotModified, ""},
+		{"miss", `"v0"`, http.StatusOK, "{\"v\":1}\n"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.Header.Set("If-None-Match", tc.etag)
+		rec := httptest.NewRecorder()
+
+		intercepted := false
+		err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone,
+			proxy.WithResponseJSONInterceptor(func(v interface{}) (interface{}, error) {
+				intercepted = true
+				return v, nil
+			}))
+		if err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.status)
+		}
+		if got := rec.Body.String(); got != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.name, got, tc.body)
+		}
+		if intercepted != (tc.status == http.StatusOK) {
+			t.Errorf("%s: JSON interceptor run = %v", tc.name, intercepted)
+		}
+		if tc.status == http.StatusNotModified {
+			for _, h := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+				if rec.Header().Get(h) == "" {
+					t.Errorf("%s: missing %s", tc.name, h)
+				}
+			}
+		}
+	}
+}
+
+func TestProxyConditionalHeadersAllowList(t *testing.T) {
+	upstream := newConditionalUpstream()
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		name   string
+		opts   []proxy.Option
+		status int
+	}{
+		{"not allowed", []proxy.Option{proxy.WithRequestHeaderAllowList("Accept")}, http.StatusOK},
+		{"allowed", []proxy.Option{proxy.WithRequestHeaderAllowList("If-None-Match")}, http.StatusNotModified},
+		{
+			"policy",
+			[]proxy.Option{proxy.WithRequestHeaderPolicy(proxy.RequestHeaderPolicy{Allow: []string{"Accept"}})},
+			http.StatusOK,
+		},
+		{
+			"opt in",
+			[]proxy.Option{proxy.WithRequestHeaderAllowList("Accept"), proxy.WithConditionalRequestHeaders()},
+			http.StatusNotModified,
+		},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+		req.Header.Set("If-None-Match", `"v1"`)
+		rec := httptest.NewRecorder()
+
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, tc.opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.status)
+		}
+	}
+}
+
+func TestProxyStripPathPrefix(t *testing.T) {
+	upstream := newEchoUpstream()
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		target string
+		status int
+		body   string
+		err    error
+	}{
+		{"/api/v1/users?id=1", http.StatusOK, "/v2/users?id=1 ", nil},
+		{"/other/users", http.StatusNotFound, "Not Found\n", proxy.ErrPathNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		rec := httptest.NewRecorder()
+
+		err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone,
+			proxy.WithStripPathPrefix("/api/v1"), proxy.WithPathPrefix("/v2"))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: err = %v, want %v", tc.target, err, tc.err)
+		}
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.target, rec.Code, tc.status)
+		}
+		if got := rec.Body.String(); got != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.target, got, tc.body)
+		}
+	}
+}
+
+func renameXMLElements(from, to string) func(*xml.Decoder, *xml.Encoder) error {
+	return func(dec *xml.Decoder, enc *xml.Encoder) error {
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == from {
+					t.Name.Local = to
+				}
+				tok = t
+			case xml.EndElement:
+				if t.Name.Local == from {
+					t.Name.Local = to
+				}
+				tok = t
+			}
+			if err := enc.EncodeToken(tok); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func TestInterceptXML(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		out  string
+		err  bool
+	}{
+		{
+			"declaration",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n<a>1</a>",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n<b>1</b>",
+			false,
+		},
+		{"no declaration", "<a>1</a>", "<b>1</b>", false},
+		{"other encoding", `<?xml version="1.0" encoding="ISO-8859-1"?><a>1</a>`, "", true},
+	} {
+		var buf bytes.Buffer
+		err := interceptXML(strings.NewReader(tc.in), &buf, renameXMLElements("a", "b"))
+		if (err != nil) != tc.err {
+			t.Errorf("%s: err = %v", tc.name, err)
+		}
+		if !tc.err && buf.String() != tc.out {
+			t.Errorf("%s: out = %q, want %q", tc.name, buf.String(), tc.out)
+		}
+	}
+}
+
+func TestProxyXMLAPI(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		io.Copy(w, r.Body)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	body := `<?xml version="1.0"?><a><c>1</c></a>`
+	req := httptest.NewRequest(http.MethodPost, "/soap", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	err := c.ProxyXMLAPI("", "", req, rec,
+		proxy.WithRequestXMLInterceptor(renameXMLElements("a", "b")),
+		proxy.WithResponseXMLInterceptor(renameXMLElements("c", "d")))
+	if err != nil {
+		t.Fatalf("ProxyXMLAPI: %v", err)
+	}
+
+	if want := `<?xml version="1.0"?><b><d>1</d></b>`; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/xml; charset=utf-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+func TestProxyKeyCaseTransform(t *testing.T) {
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		upstreamBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user_id":1,"order_items":[{"item_id":2}]}`))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"userId":1,"orderItems":[{"itemId":2}]}`))
+	rec := httptest.NewRecorder()
+
+	err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeRaw,
+		proxy.WithKeyCaseTransform(proxy.CaseDirectionCamelToSnake))
+	if err != nil {
+		t.Fatalf("ProxyAPI: %v", err)
+	}
+
+	if want := `{"order_items":[{"item_id":2}],"user_id":1}` + "\n"; upstreamBody != want {
+		t.Errorf("upstream body = %q, want %q", upstreamBody, want)
+	}
+	if want := `{"orderItems":[{"itemId":2}],"userId":1}` + "\n"; rec.Body.String() != want {
+		t.Errorf("response body = %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestProxyRedirects(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new?x=1", http.StatusFound)
+			return
+		}
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		name     string
+		opts     []proxy.Option
+		status   int
+		location string
+		body     string
+	}{
+		{"passed through", nil, http.StatusFound, "/new?x=1", ""},
+		{"followed", []proxy.Option{proxy.WithFollowRedirects(true)}, http.StatusOK, "", "/new?x=1"},
+	} {
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/old", nil), rec, proxy.RequestBodyTypeNone, tc.opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.status)
+		}
+		if got := rec.Header().Get("Location"); got != tc.location {
+			t.Errorf("%s: Location = %q, want %q", tc.name, got, tc.location)
+		}
+		if tc.body != "" && rec.Body.String() != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.name, rec.Body.String(), tc.body)
+		}
+	}
+}
+
+func TestProxyJSONUseNumber(t *testing.T) {
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		upstreamBody = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	for _, tc := range []struct {
+		name string
+		opts []proxy.Option
+		want string
+	}{
+		{"float64", nil, `{"id":12345678901234568}` + "\n"},
+		{"json.Number", []proxy.Option{proxy.WithJSONUseNumber()}, `{"id":12345678901234567}` + "\n"},
+	} {
+		var types []string
+		recordType := func(v interface{}) (interface{}, error) {
+			types = append(types, fmt.Sprintf("%T", v.(map[string]interface{})["id"]))
+			return v, nil
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/ids", strings.NewReader(`{"id":12345678901234567}`))
+		rec := httptest.NewRecorder()
+
+		opts := append([]proxy.Option{
+			proxy.WithRequestJSONInterceptor(recordType),
+			proxy.WithResponseJSONInterceptor(recordType),
+		}, tc.opts...)
+		if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeRaw, opts...); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+
+		if upstreamBody != tc.want {
+			t.Errorf("%s: upstream body = %q, want %q", tc.name, upstreamBody, tc.want)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: response body = %q, want %q", tc.name, got, tc.want)
+		}
+		if want := []string{tc.name, tc.name}; fmt.Sprint(types) != fmt.Sprint(want) {
+			t.Errorf("%s: interceptors got %v, want %v", tc.name, types, want)
+		}
+	}
+}
+
+func TestProxyOrderedJSON(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"z":1,"a":{"y":2,"b":3},"m":[{"k":1,"c":2}]}`))
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+
+	rec := httptest.NewRecorder()
+	err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/signed", nil), rec, proxy.RequestBodyTypeNone,
+		proxy.WithOrderedJSON(),
+		proxy.WithResponseJSONInterceptor(func(v interface{}) (interface{}, error) {
+			obj := v.(proxy.OrderedMap)
+			nested, _ := obj.Get("a")
+			a := nested.(proxy.OrderedMap)
+			a.Set("x", 4)
+			obj.Set("a", a)
+			return obj, nil
+		}))
+	if err != nil {
+		t.Fatalf("ProxyAPI: %v", err)
+	}
+
+	if want := `{"z":1,"a":{"y":2,"b":3,"x":4},"m":[{"k":1,"c":2}]}` + "\n"; rec.Body.String() != want {
+		t.Errorf("body = %q, want %q", rec.Body.String(), want)
+	}
+}
+
+func TestProxyUpstreamResolver(t *testing.T) {
+	newNamedUpstream := func(name string, hits *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(hits, 1)
+			w.Write([]byte(name + " " + r.URL.Path))
+		}))
+	}
+
+	var hits int32
+	tenantA := newNamedUpstream("a", &hits)
+	defer tenantA.Close()
+	tenantB := newNamedUpstream("b", &hits)
+	defer tenantB.Close()
+	fallback := newNamedUpstream("default", &hits)
+	defer fallback.Close()
+
+	bases := map[string]string{"a": tenantA.URL, "b": tenantB.URL + "/v1"}
+	errUnknownTenant := errors.New("unknown tenant")
+
+	resolver := proxy.WithUpstreamResolver(func(r *http.Request) (*url.URL, error) {
+		tenant := r.Header.Get("X-Tenant")
+		if tenant == "" {
+			return nil, nil
+		}
+		base, ok := bases[tenant]
+		if !ok {
+			return nil, errUnknownTenant
+		}
+		return url.Parse(base)
+	})
+
+	var handled error
+	errorHandler := proxy.WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	c := NewClient(WithBaseURL(fallback.URL))
+
+	for _, tc := range []struct {
+		tenant string
+		code   int
+		body   string
+	}{
+		{"a", http.StatusOK, "a /users"},
+		{"b", http.StatusOK, "b /v1/users"},
+		{"", http.StatusOK, "default /users"},
+		{"c", http.StatusBadRequest, ""},
+	} {
+		atomic.StoreInt32(&hits, 0)
+		handled = nil
+
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		if tc.tenant != "" {
+			req.Header.Set("X-Tenant", tc.tenant)
+		}
+
+		rec := httptest.NewRecorder()
+		err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, resolver, errorHandler)
+
+		if rec.Code != tc.code || rec.Body.String() != tc.body {
+			t.Errorf("tenant %q: got %d %q, want %d %q", tc.tenant, rec.Code, rec.Body.String(), tc.code, tc.body)
+		}
+		if tc.code != http.StatusOK {
+			if !errors.Is(err, errUnknownTenant) || !errors.Is(handled, errUnknownTenant) {
+				t.Errorf("tenant %q: err = %v, handled %v, want the resolver error", tc.tenant, err, handled)
+			}
+			if atomic.LoadInt32(&hits) != 0 {
+				t.Errorf("tenant %q: %d upstream requests, want none", tc.tenant, hits)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QuotaHeaders are the names of the upstream response headers carrying the
+// quota. They default to X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset. The reset is either a number of seconds from now, or a
+// unix timestamp.
+type QuotaHeaders struct {
+	Limit     string
+	Remaining string
+	Reset     string
+}
+
+func (h QuotaHeaders) withDefaults() QuotaHeaders {
+	if h.Limit == "" {
+		h.Limit = "X-RateLimit-Limit"
+	}
+	if h.Remaining == "" {
+		h.Remaining = "X-RateLimit-Remaining"
+	}
+	if h.Reset == "" {
+		h.Reset = "X-RateLimit-Reset"
+	}
+
+	return h
+}
+
+// Quota is the upstream quota, as last reported. Remaining is decremented as
+// requests are sent, until the next response reports it.
+type Quota struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	UpdatedAt time.Time
+}
+
+// quotaTracker delays the requests until the reset once the quota is used up.
+type quotaTracker struct {
+	headers  QuotaHeaders
+	failFast bool
+
+	mu    sync.Mutex
+	quota Quota
+	known bool
+}
+
+func newQuotaTracker(headers *QuotaHeaders, failFast bool) *quotaTracker {
+	if headers == nil {
+		return nil
+	}
+
+	return &quotaTracker{headers: headers.withDefaults(), failFast: failFast}
+}
+
+func (t *quotaTracker) get() (Quota, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.quota, t.known
+}
+
+// acquire takes a request from the quota, waiting for the reset if there's
+// none left.
+func (t *quotaTracker) acquire(ctx context.Context) error {
+	t.mu.Lock()
+
+	now := time.Now()
+	if !t.known || t.quota.Remaining > 0 {
+		t.quota.Remaining--
+		t.mu.Unlock()
+		return nil
+	}
+	if !now.Before(t.quota.Reset) {
+		// the upstream is trusted to have reset it
+		t.quota.Remaining = t.quota.Limit - 1
+		t.mu.Unlock()
+		return nil
+	}
+
+	delay := t.quota.Reset.Sub(now)
+	t.mu.Unlock()
+
+	if t.failFast {
+		return ErrRateLimited
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		return ErrRateLimited
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return t.acquire(ctx)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// update records the quota reported by the response, if any.
+func (t *quotaTracker) update(header http.Header, now time.Time) {
+	remaining, err := strconv.Atoi(header.Get(t.headers.Remaining))
+	if err != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.quota.Remaining = remaining
+	t.quota.UpdatedAt = now
+	t.known = true
+
+	if limit, err := strconv.Atoi(header.Get(t.headers.Limit)); err == nil {
+		t.quota.Limit = limit
+	}
+	if reset, err := strconv.ParseInt(header.Get(t.headers.Reset), 10, 64); err == nil {
+		t.quota.Reset = quotaReset(reset, now)
+	}
+}
+
+// unix timestamps are told from delays by their size
+const minResetTimestamp = 1e9
+
+func quotaReset(reset int64, now time.Time) time.Time {
+	if reset >= minResetTimestamp {
+		return time.Unix(reset, 0)
+	}
+
+	return now.Add(time.Duration(reset) * time.Second)
+}
+
+// quotaTransport sends the requests within the upstream quota, and tracks it.
+type quotaTransport struct {
+	base    http.RoundTripper
+	tracker *quotaTracker
+}
+
+func (t *quotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.tracker.acquire(req.Context()); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.tracker.update(res.Header, time.Now())
+	}
+
+	return res, err
+}
+
+// Quota returns the upstream quota last reported, and false if quota tracking
+// is disabled or no response reported it yet.
+func (c *Client) Quota() (Quota, bool) {
+	if c.quota == nil {
+		return Quota{}, false
+	}
+
+	return c.quota.get()
+}
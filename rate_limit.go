@@ -0,0 +1,146 @@
+package api_client
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// ErrRateLimited is returned when a request can't be sent under the client's
+// rate limits, either right away with WithRateLimitFailFast, or before its
+// context deadline. It's wrapped in the returned error, and proxied requests
+// get a 429. It's proxy.ErrRateLimited.
+var ErrRateLimited = proxy.ErrRateLimited
+
+// RateLimit is a token bucket applied to the requests with a path matching
+// Pattern.
+type RateLimit struct {
+	Pattern string
+	RPS     float64
+	Burst   int
+}
+
+type rateLimitRule struct {
+	pattern string
+	limiter *rate.Limiter
+}
+
+// rateLimiter holds the token buckets of the client, shared by its requests.
+type rateLimiter struct {
+	rules    []rateLimitRule
+	failFast bool
+}
+
+func newRateLimiter(limits []RateLimit, failFast bool) *rateLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+
+	l := &rateLimiter{failFast: failFast}
+	for _, limit := range limits {
+		// such a bucket would never grant a token
+		if limit.RPS <= 0 {
+			panic("api_client: rate limit rps for " + limit.Pattern + " must be positive")
+		}
+
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+
+		l.rules = append(l.rules, rateLimitRule{
+			pattern: limit.Pattern,
+			limiter: rate.NewLimiter(rate.Limit(limit.RPS), burst),
+		})
+	}
+
+	return l
+}
+
+// wait takes a token from every bucket matching the path, or none of them.
+func (l *rateLimiter) wait(ctx context.Context, urlPath string) error {
+	now := time.Now()
+
+	var reservations []*rate.Reservation
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+
+	var delay time.Duration
+	for _, rule := range l.rules {
+		if !rateLimitMatches(rule.pattern, urlPath) {
+			continue
+		}
+
+		r := rule.limiter.ReserveN(now, 1)
+		if !r.OK() {
+			cancel()
+			return ErrRateLimited
+		}
+		reservations = append(reservations, r)
+
+		if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+
+	if delay == 0 {
+		return nil
+	}
+
+	if l.failFast {
+		cancel()
+		return ErrRateLimited
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		cancel()
+		return ErrRateLimited
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+}
+
+// rateLimitMatches reports whether the pattern, matched with path.Match,
+// matches the path. "*" and "" match every path.
+func rateLimitMatches(pattern, urlPath string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+
+	ok, _ := path.Match(pattern, urlPath)
+
+	return ok
+}
+
+// rateLimitTransport waits for the rate limits before sending the requests.
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.wait(req.Context(), req.URL.Path); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req)
+}
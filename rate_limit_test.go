@@ -0,0 +1,32 @@
+package api_client
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRateLimitDefaultBurst(t *testing.T) {
+	l := newRateLimiter([]RateLimit{{Pattern: "*", RPS: 1}}, true)
+
+	if err := l.wait(context.Background(), "/x"); err != nil {
+		t.Fatalf("first request: %v, want it allowed", err)
+	}
+	if err := l.wait(context.Background(), "/x"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("second request: %v, want ErrRateLimited", err)
+	}
+}
+
+func TestRateLimitRejectsNonPositiveRPS(t *testing.T) {
+	for _, rps := range []float64{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("rps %v: NewClient didn't panic", rps)
+				}
+			}()
+
+			NewClient(WithRateLimit("*", rps, 1))
+		}()
+	}
+}
@@ -1,9 +1,13 @@
 package request
 
 import (
-	"github.com/operaads/api-client/interceptor"
+	"context"
 	"io"
+	"net/http"
 	"time"
+
+	"github.com/operaads/api-client/interceptor"
+	"github.com/operaads/api-client/retry"
 )
 
 type APIRequest struct {
@@ -11,10 +15,44 @@ type APIRequest struct {
 	URL    string
 	Body   io.Reader
 
+	// Context is the parent context of the request, the request timeout is
+	// applied on top of it.
+	Context context.Context
+
+	// RequestTimeout overrides the client request timeout, a negative one
+	// disables it.
 	RequestTimeout time.Duration
 
+	// PathTemplate labels the request metrics instead of the path, e.g.
+	// "/users/{id}", to keep their cardinality low.
+	PathTemplate string
+
+	// CheckRedirect overrides the client's redirect policy for this request.
+	CheckRedirect func(req *http.Request, via []*http.Request) error
+
 	URLInterceptors     []interceptor.URLInterceptor
 	RequestInterceptors []interceptor.RequestInterceptor
+
+	// Transports wrap the client's transport for this request, in order, so
+	// that the last one is the outermost.
+	Transports []func(http.RoundTripper) http.RoundTripper
+
+	// RetryPolicy overrides the client's retry policy for this request.
+	RetryPolicy *retry.Policy
+
+	// HedgePolicy, if set, hedges the request when it's slow.
+	HedgePolicy *retry.HedgePolicy
+
+	// SendHooks run in order after the request interceptors, right before the
+	// request is sent. The request is not sent if any of them fails.
+	SendHooks []func(*http.Request) error
+
+	// BodyEncoding, if set, is the content coding the body is compressed with,
+	// "gzip" or "zstd".
+	BodyEncoding string
+
+	// Signer, if set, signs the request after the send hooks.
+	Signer func(*http.Request) error
 }
 
 type Option func(*APIRequest)
@@ -59,12 +97,79 @@ func AppendRequestInterceptors(intcps ...interceptor.RequestInterceptor) Option
 	}
 }
 
+func AppendSendHooks(hooks ...func(*http.Request) error) Option {
+	return func(r *APIRequest) {
+		r.SendHooks = append(r.SendHooks, hooks...)
+	}
+}
+
+func WithContext(ctx context.Context) Option {
+	return func(r *APIRequest) {
+		r.Context = ctx
+	}
+}
+
+func AppendTransports(transports ...func(http.RoundTripper) http.RoundTripper) Option {
+	return func(r *APIRequest) {
+		r.Transports = append(r.Transports, transports...)
+	}
+}
+
 func WithRequestTimeout(timeout time.Duration) Option {
 	return func(r *APIRequest) {
 		r.RequestTimeout = timeout
 	}
 }
 
+func WithCheckRedirect(checkRedirect func(req *http.Request, via []*http.Request) error) Option {
+	return func(r *APIRequest) {
+		r.CheckRedirect = checkRedirect
+	}
+}
+
+// WithGzipRequestBody gzips the body, and sets the Content-Encoding. Bodies
+// the request interceptors already gave a Content-Encoding are left as is.
+// Bodies in memory are compressed before the request is sent, so that they
+// can be retried, others are compressed as they are sent.
+func WithGzipRequestBody() Option {
+	return WithRequestBodyEncoding("gzip")
+}
+
+// WithZstdRequestBody is like WithGzipRequestBody, with zstd.
+func WithZstdRequestBody() Option {
+	return WithRequestBodyEncoding("zstd")
+}
+
+func WithRequestBodyEncoding(coding string) Option {
+	return func(r *APIRequest) {
+		r.BodyEncoding = coding
+	}
+}
+
+func WithSigner(signer func(*http.Request) error) Option {
+	return func(r *APIRequest) {
+		r.Signer = signer
+	}
+}
+
+func WithPathTemplate(template string) Option {
+	return func(r *APIRequest) {
+		r.PathTemplate = template
+	}
+}
+
+func WithRetryPolicy(policy *retry.Policy) Option {
+	return func(r *APIRequest) {
+		r.RetryPolicy = policy
+	}
+}
+
+func WithHedging(policy *retry.HedgePolicy) Option {
+	return func(r *APIRequest) {
+		r.HedgePolicy = policy
+	}
+}
+
 func NewAPIRequest(method, url string, body io.Reader, opts ...Option) *APIRequest {
 	r := &APIRequest{
 		Method: method,
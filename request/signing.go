@@ -0,0 +1,124 @@
+package request
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type HMACAlgorithm string
+
+const (
+	HMACSHA256 HMACAlgorithm = "hmac-sha256"
+	HMACSHA512 HMACAlgorithm = "hmac-sha512"
+)
+
+var ErrUnknownHMACAlgorithm = errors.New("request: unknown HMAC algorithm")
+
+const (
+	SignatureKeyIDHeader     = "X-Signature-Key-Id"
+	SignatureAlgorithmHeader = "X-Signature-Algorithm"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureHeader          = "X-Signature"
+	ContentDigestHeader      = "X-Content-Digest"
+)
+
+func (a HMACAlgorithm) hash() (func() hash.Hash, bool) {
+	switch a {
+	case HMACSHA256:
+		return sha256.New, true
+	case HMACSHA512:
+		return sha512.New, true
+	default:
+		return nil, false
+	}
+}
+
+// WithHMACSigning signs the request right before it's sent, after the other
+// send hooks. The signature is the base64 HMAC of the method, the request URI,
+// the unix timestamp and the hex digest of the body, separated by newlines.
+// They're sent in the signature headers, along with the key ID.
+//
+// The body is hashed from a copy when it can be replayed, and is read into
+// memory otherwise.
+func WithHMACSigning(keyID, secret string, algo HMACAlgorithm) Option {
+	return WithSigner(HMACSigner(keyID, secret, algo))
+}
+
+// HMACSigner returns the signer of WithHMACSigning.
+func HMACSigner(keyID, secret string, algo HMACAlgorithm) func(*http.Request) error {
+	return func(req *http.Request) error {
+		return signRequest(req, keyID, []byte(secret), algo, time.Now())
+	}
+}
+
+func signRequest(req *http.Request, keyID string, secret []byte, algo HMACAlgorithm, now time.Time) error {
+	newHash, ok := algo.hash()
+	if !ok {
+		return ErrUnknownHMACAlgorithm
+	}
+
+	digest, err := bodyDigest(req, newHash)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	mac := hmac.New(newHash, secret)
+	io.WriteString(mac, req.Method+"\n"+req.URL.RequestURI()+"\n"+timestamp+"\n"+digest)
+
+	req.Header.Set(SignatureKeyIDHeader, keyID)
+	req.Header.Set(SignatureAlgorithmHeader, string(algo))
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(ContentDigestHeader, digest)
+	req.Header.Set(SignatureHeader, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return nil
+}
+
+// bodyDigest returns the hex digest of the body, leaving it unread.
+func bodyDigest(req *http.Request, newHash func() hash.Hash) (string, error) {
+	h := newHash()
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	if req.GetBody == nil {
+		// buffered, so that it can be hashed and sent
+		buf, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		req.ContentLength = int64(len(buf))
+		req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(buf)), nil
+		}
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,242 @@
+package api_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/operaads/api-client/breaker"
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/retry"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 10 * time.Second
+)
+
+// retryBackoff returns the exponential backoff with full jitter before the
+// given retry, counted from 1.
+func retryBackoff(n int, base, max time.Duration) time.Duration {
+	if base <= 0 {
+		base = defaultRetryBackoff
+	}
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+
+	d := base
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// parseRetryAfter parses a Retry-After header, in either delta-seconds or
+// HTTP-date form.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+
+	return 0, true
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// sleepContext waits for d, and reports false without waiting if the context
+// is done before, or will be by then.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// discardResponse drains a bit of the body, so that the connection can be
+// reused, and closes it.
+func discardResponse(res *http.Response) {
+	io.CopyN(ioutil.Discard, res.Body, 4<<10)
+	res.Body.Close()
+}
+
+// retryTransport retries requests according to the policy, sending the body
+// again when it can be replayed.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy *retry.Policy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attemptReq := req
+
+	var attempts []proxy.Attempt
+
+	for attempt := 1; ; attempt++ {
+		res, err := t.base.RoundTrip(attemptReq)
+		if err != nil {
+			attempts = appendAttempts(attempts, req.URL.Host, err)
+		}
+		if attempt >= t.policy.Attempts() || !t.retryable(req, res, err) {
+			return res, attemptsError(attempts, err)
+		}
+
+		next, ok := replayRequest(req)
+		if !ok {
+			return res, attemptsError(attempts, err)
+		}
+
+		delay := retryBackoff(attempt, t.policy.Backoff, t.policy.MaxBackoff)
+		if res != nil {
+			if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok && retryAfter > delay {
+				delay = retryAfter
+			}
+		}
+		if !sleepContext(req.Context(), delay) {
+			if next != req {
+				next.Body.Close()
+			}
+			return res, attemptsError(attempts, err)
+		}
+
+		if res != nil {
+			upstream := req.URL.Host
+			if res.Request != nil {
+				upstream = res.Request.URL.Host
+			}
+			attempts = append(attempts, proxy.Attempt{
+				Upstream: upstream,
+				Err:      fmt.Errorf("upstream responded %s", res.Status),
+			})
+
+			discardResponse(res)
+		}
+
+		attemptReq = next
+	}
+}
+
+// appendAttempts adds the attempts of an ExhaustedError, e.g. of a host
+// policy or the balancer, or else err as an attempt to the host.
+func appendAttempts(attempts []proxy.Attempt, host string, err error) []proxy.Attempt {
+	var exhaustedErr *proxy.ExhaustedError
+	if errors.As(err, &exhaustedErr) {
+		return append(attempts, exhaustedErr.Attempts...)
+	}
+
+	return append(attempts, proxy.Attempt{Upstream: host, Err: err})
+}
+
+// attemptsError returns the error of the last attempt, or an ExhaustedError
+// with every attempt if there were several.
+func attemptsError(attempts []proxy.Attempt, err error) error {
+	if err == nil || len(attempts) <= 1 {
+		return err
+	}
+
+	return &proxy.ExhaustedError{Attempts: attempts}
+}
+
+func (t *retryTransport) retryable(req *http.Request, res *http.Response, err error) bool {
+	if !t.policy.RetriesMethod(req.Method) {
+		return false
+	}
+
+	if err != nil {
+		// don't retry once the request is cancelled or the breaker is open
+		return req.Context().Err() == nil && err != breaker.ErrOpen
+	}
+
+	return t.policy.Retryable(res.StatusCode)
+}
+
+// replayRequest returns the request to send again, with a new body if it has
+// one, or false if the body can't be replayed.
+func replayRequest(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+
+	next := req.Clone(req.Context())
+	next.Body = body
+
+	return next, true
+}
+
+// replayableBody buffers the body up to max bytes, so that it can be sent
+// again on retries. A larger body is streamed as is, and isn't retried.
+func replayableBody(body io.Reader, max int64) (io.Reader, error) {
+	switch body.(type) {
+	case nil, *bytes.Buffer, *bytes.Reader, *strings.Reader:
+		return body, nil
+	}
+
+	buf := new(bytes.Buffer)
+	_, err := io.CopyN(buf, body, max+1)
+	if err == io.EOF {
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+
+		return bytes.NewReader(buf.Bytes()), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	rest := io.MultiReader(buf, body)
+	if c, ok := body.(io.Closer); ok {
+		return struct {
+			io.Reader
+			io.Closer
+		}{rest, c}, nil
+	}
+
+	return rest, nil
+}
@@ -0,0 +1,21 @@
+package retry
+
+import "time"
+
+// DefaultHedgeMinSamples is the number of response times needed before the
+// hedge delay follows the quantile.
+const DefaultHedgeMinSamples = 20
+
+// HedgePolicy configures hedged requests: when an idempotent request hasn't
+// been responded within the delay, a second one is sent, to another endpoint
+// with a load balancer, and the first response wins. The other request is
+// cancelled. Requests with a body that can't be replayed aren't hedged.
+type HedgePolicy struct {
+	// Delay is how long the first request is waited for, until there are
+	// enough response times to use Quantile.
+	Delay time.Duration
+
+	// Quantile, e.g. 0.95, sets the delay to that quantile of the recent
+	// response times of the client, once known. It's at least Delay.
+	Quantile float64
+}
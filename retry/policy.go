@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultMaxBufferBytes = 1 << 20
+)
+
+// DefaultRetryableStatus are the response status codes retried by default.
+var DefaultRetryableStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Policy configures the retries of requests that failed to reach the
+// upstream, or got a retryable response.
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// It defaults to DefaultMaxAttempts, and 1 disables retries.
+	MaxAttempts int
+
+	// Backoff and MaxBackoff bound the exponential backoff, with jitter,
+	// between attempts. They default to 100ms and 10s. A longer Retry-After
+	// sent by the upstream is honored, unless it exceeds the request deadline.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// RetryableStatus are the retried response status codes, it defaults to
+	// DefaultRetryableStatus.
+	RetryableStatus []int
+
+	// RetryNonIdempotent allows retrying requests with methods like POST,
+	// which the upstream may have already processed.
+	RetryNonIdempotent bool
+
+	// MaxBufferBytes bounds the proxied request bodies buffered so that they
+	// can be sent again. Larger bodies are streamed, and not retried. It
+	// defaults to DefaultMaxBufferBytes.
+	MaxBufferBytes int64
+}
+
+func (p *Policy) Attempts() int {
+	if p.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+
+	return p.MaxAttempts
+}
+
+func (p *Policy) BufferBytes() int64 {
+	if p.MaxBufferBytes <= 0 {
+		return DefaultMaxBufferBytes
+	}
+
+	return p.MaxBufferBytes
+}
+
+// Retryable reports whether a response with the status code is retried.
+func (p *Policy) Retryable(status int) bool {
+	retryable := p.RetryableStatus
+	if retryable == nil {
+		retryable = DefaultRetryableStatus
+	}
+
+	for _, s := range retryable {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RetriesMethod reports whether requests with the method are retried.
+func (p *Policy) RetriesMethod(method string) bool {
+	if p.RetryNonIdempotent {
+		return true
+	}
+
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
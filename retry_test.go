@@ -0,0 +1,227 @@
+package api_client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/balancer"
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/retry"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"2", 2 * time.Second, true},
+		{" 0 ", 0, true},
+		{now.Add(3 * time.Second).Format(http.TimeFormat), 3 * time.Second, true},
+		{now.Add(-time.Second).Format(http.TimeFormat), 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	} {
+		got, ok := parseRetryAfter(tc.value, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		retryAfter func() string
+	}{
+		{"delta seconds", func() string { return "1" }},
+		{"http date", func() string { return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat) }},
+	} {
+		var hits int32
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&hits, 1) == 1 {
+				w.Header().Set("Retry-After", tc.retryAfter())
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+		}))
+
+		c := NewClient(WithBaseURL(upstream.URL))
+		policy := proxy.WithHostPolicy(map[string]proxy.HostPolicy{
+			upstream.Listener.Addr().String(): {Retries: 1, RetryBackoff: time.Millisecond},
+		})
+
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		if err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/x", nil), rec, proxy.RequestBodyTypeNone, policy); err != nil {
+			t.Fatalf("%s: ProxyAPI: %v", tc.name, err)
+		}
+		elapsed := time.Since(start)
+		upstream.Close()
+
+		if rec.Code != http.StatusOK || hits != 2 {
+			t.Errorf("%s: status = %d after %d attempts, want 200 after 2", tc.name, rec.Code, hits)
+		}
+		// an HTTP date has a second resolution
+		if elapsed < 900*time.Millisecond {
+			t.Errorf("%s: retried after %v, before the Retry-After", tc.name, elapsed)
+		}
+	}
+}
+
+func TestRetryAfterCappedByDeadline(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	policy := proxy.WithHostPolicy(map[string]proxy.HostPolicy{
+		upstream.Listener.Addr().String(): {Retries: 3},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/x", nil).WithContext(ctx)
+	if err := c.ProxyAPI("", "", req, rec, proxy.RequestBodyTypeNone, policy); err != nil {
+		t.Fatalf("ProxyAPI: %v", err)
+	}
+
+	if rec.Code != http.StatusTooManyRequests || hits != 1 {
+		t.Errorf("status = %d after %d attempts, want the 429 after 1", rec.Code, hits)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("gave up after %v, want immediately", elapsed)
+	}
+}
+
+func TestTotalDeadlineStopsRetries(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		select {
+		case <-time.After(200 * time.Millisecond):
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL))
+	opts := []proxy.Option{
+		proxy.WithHostPolicy(map[string]proxy.HostPolicy{
+			upstream.Listener.Addr().String(): {Retries: 2, RetryBackoff: time.Millisecond},
+		}),
+		proxy.WithTotalDeadline(300 * time.Millisecond),
+	}
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	err := c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/x", nil), rec, proxy.RequestBodyTypeNone, opts...)
+	elapsed := time.Since(start)
+
+	if !errors.Is(err, proxy.ErrTotalDeadlineExceeded) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want ErrTotalDeadlineExceeded", err)
+	}
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want 504", rec.Code)
+	}
+	if got := atomic.LoadInt32(&hits); got != 2 {
+		t.Errorf("upstream hits = %d, want 2", got)
+	}
+	// the three attempts would take 600ms
+	if elapsed > 500*time.Millisecond {
+		t.Errorf("gave up after %v", elapsed)
+	}
+}
+
+func TestHostPolicyRetriesIdempotentMethods(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	host := upstream.Listener.Addr().String()
+	upstream.Close()
+
+	for _, tc := range []struct {
+		method        string
+		nonIdempotent bool
+		attempts      int
+	}{
+		{http.MethodGet, false, 3},
+		{http.MethodPut, false, 3},
+		{http.MethodPost, false, 1},
+		{http.MethodPatch, false, 1},
+		{http.MethodPost, true, 3},
+	} {
+		rt := &recordingTransport{}
+		c := NewClient(WithBaseURL("http://"+host), WithTransport(rt))
+		policy := proxy.WithHostPolicy(map[string]proxy.HostPolicy{
+			host: {Retries: 2, RetryBackoff: time.Millisecond, RetryNonIdempotent: tc.nonIdempotent},
+		})
+
+		req := httptest.NewRequest(tc.method, "/x", strings.NewReader("a=1"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err := c.ProxyAPI("", "", req, httptest.NewRecorder(), proxy.RequestBodyTypeForm, policy); err == nil {
+			t.Fatalf("%s: ProxyAPI succeeded with the connection refused", tc.method)
+		}
+
+		if len(rt.paths) != tc.attempts {
+			t.Errorf("%s (non-idempotent retries %v): sent %d times, want %d", tc.method, tc.nonIdempotent, len(rt.paths), tc.attempts)
+		}
+	}
+}
+
+func TestRetryPolicyReportsEveryAttempt(t *testing.T) {
+	var dead []string
+	for i := 0; i < 2; i++ {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		dead = append(dead, upstream.URL)
+		upstream.Close()
+	}
+
+	lb, err := balancer.NewFromURLs(balancer.RoundRobin, dead...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClient(WithLoadBalancer(lb), WithRetryPolicy(retry.Policy{MaxAttempts: 2, Backoff: time.Millisecond}))
+
+	var events []proxy.Event
+	observer := proxy.WithObserver(func(e proxy.Event) {
+		events = append(events, e)
+	})
+
+	err = c.ProxyAPI("", "", httptest.NewRequest(http.MethodGet, "/x", nil), httptest.NewRecorder(), proxy.RequestBodyTypeNone, observer)
+
+	var exhaustedErr *proxy.ExhaustedError
+	if !errors.As(err, &exhaustedErr) {
+		t.Fatalf("err = %v, want an ExhaustedError", err)
+	}
+
+	var upstreams []string
+	for _, a := range exhaustedErr.Attempts {
+		upstreams = append(upstreams, "http://"+a.Upstream)
+	}
+	sort.Strings(upstreams)
+	sort.Strings(dead)
+	if !reflect.DeepEqual(upstreams, dead) {
+		t.Errorf("attempted %q, want both endpoints %q", upstreams, dead)
+	}
+
+	if len(events) != 1 || events[0].Type != proxy.EventTypeUpstreamsExhausted || events[0].Err != exhaustedErr {
+		t.Errorf("events = %+v, want one UPSTREAMS_EXHAUSTED event with the error", events)
+	}
+}
@@ -0,0 +1,144 @@
+package api_client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/operaads/api-client/response"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultSingleflightMaxBytes = 1 << 20
+
+var errNotShareable = errors.New("response too large to share")
+
+type sharedResponse struct {
+	res  *http.Response
+	body []byte
+}
+
+func (r *sharedResponse) clone() *response.APIResponse {
+	res := new(http.Response)
+	*res = *r.res
+
+	res.Header = r.res.Header.Clone()
+	res.Trailer = r.res.Trailer.Clone()
+	res.Body = ioutil.NopCloser(bytes.NewReader(r.body))
+	res.ContentLength = int64(len(r.body))
+
+	return &response.APIResponse{Response: res}
+}
+
+// doSingleflight shares the response of do with concurrent callers using the
+// same key. Responses larger than maxBytes aren't shared, every caller then
+// does its own request.
+//
+// The shared request is done with a context detached from the one of the
+// caller doing it, so that the others still get the response if it goes
+// away, and is bounded by the request timeout. Each caller stops waiting once
+// its own ctx is done.
+func (c *Client) doSingleflight(
+	ctx context.Context,
+	key string,
+	maxBytes int64,
+	do func(ctx context.Context) (*response.APIResponse, error),
+) (*response.APIResponse, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSingleflightMaxBytes
+	}
+
+	// only set if this caller did the request, read once it's done
+	var own *response.APIResponse
+
+	ch := c.flight.DoChan(key, func() (interface{}, error) {
+		res, err := do(detachedContext{ctx})
+		if err != nil {
+			return nil, err
+		}
+
+		body, ok, err := bufferBody(res, res.Body, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			own = res
+			return nil, errNotShareable
+		}
+
+		return &sharedResponse{res: res.Response, body: body}, nil
+	})
+
+	var result singleflight.Result
+	select {
+	case result = <-ch:
+	case <-ctx.Done():
+		go func() {
+			<-ch
+			if own != nil {
+				own.Body.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+
+	if own != nil {
+		return own, nil
+	}
+	if result.Err == errNotShareable {
+		return do(ctx)
+	}
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	return result.Val.(*sharedResponse).clone(), nil
+}
+
+// detachedContext keeps the values of its parent, but not its deadline and
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// bufferBody reads the body of res from reader up to maxBytes and closes it.
+// If the body is larger, it's left unread in res, and ok is false.
+func bufferBody(res *response.APIResponse, reader io.Reader, maxBytes int64) (body []byte, ok bool, err error) {
+	body, err = ioutil.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, false, err
+	}
+
+	if int64(len(body)) > maxBytes {
+		if reader != res.Body {
+			// already decoded, the encoding no longer applies
+			res.Header.Del("Content-Encoding")
+			res.Header.Del("Content-Length")
+			res.ContentLength = -1
+		}
+
+		res.Body = &struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), reader), res.Body}
+
+		return nil, false, nil
+	}
+
+	res.Body.Close()
+
+	return body, true, nil
+}
@@ -0,0 +1,56 @@
+package api_client
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// ProxyAPITo is like ProxyAPIWithResult, but writes the response body to w,
+// e.g. a buffer or a file. onHeader, if not nil, is called with the status
+// code and the headers before the body is written.
+func (c *Client) ProxyAPITo(
+	w io.Writer,
+	onHeader func(status int, header http.Header),
+	method, path string,
+	httpReq *http.Request,
+	reqBodyType proxy.RequestBodyType,
+	opts ...proxy.Option,
+) (proxy.Result, error) {
+	resWriter := &writerResponseWriter{
+		Writer:   w,
+		header:   make(http.Header),
+		onHeader: onHeader,
+	}
+
+	return c.ProxyAPIWithResult(method, path, httpReq, resWriter, reqBodyType, opts...)
+}
+
+// writerResponseWriter adapts an io.Writer to http.ResponseWriter.
+type writerResponseWriter struct {
+	io.Writer
+	header      http.Header
+	onHeader    func(int, http.Header)
+	wroteHeader bool
+}
+
+func (w *writerResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *writerResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if w.onHeader != nil {
+		w.onHeader(status, w.header)
+	}
+}
+
+func (w *writerResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.Writer.Write(p)
+}
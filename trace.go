@@ -0,0 +1,80 @@
+package api_client
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// traceTransport reports the timings of each request sent with base.
+type traceTransport struct {
+	base    http.RoundTripper
+	opt     *proxy.Options
+	httpReq *http.Request
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		mu                               sync.Mutex
+		timings                          proxy.Timings
+		dnsStart, connectStart, tlsStart time.Time
+	)
+
+	// callbacks may be called concurrently, and after RoundTrip returns when
+	// dialing loses the race to an idle connection
+	record := func(fn func()) {
+		mu.Lock()
+		fn()
+		mu.Unlock()
+	}
+
+	start := time.Now()
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func() { dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func() { timings.DNSLookup = time.Since(dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			record(func() { connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			record(func() { timings.Connect = time.Since(connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			record(func() { tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { timings.TLSHandshake = time.Since(tlsStart) })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { timings.ConnReused = info.Reused })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { timings.TimeToFirstByte = time.Since(start) })
+		},
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	res, err := t.base.RoundTrip(req)
+
+	mu.Lock()
+	e := proxy.Event{
+		Type:     proxy.EventTypeTimings,
+		Request:  t.httpReq,
+		Err:      err,
+		Upstream: req.URL.Host,
+		Timings:  timings,
+	}
+	mu.Unlock()
+
+	t.opt.Notify(e)
+
+	return res, err
+}
@@ -0,0 +1,57 @@
+package api_client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/operaads/api-client/proxy"
+	"github.com/operaads/api-client/tracing"
+)
+
+func startRequestSpan(ctx context.Context, tracer tracing.Tracer, method string, fullURL *url.URL) (context.Context, tracing.Span) {
+	ctx, span := tracer.Start(ctx, "HTTP "+method, tracing.SpanKindClient)
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.url", fullURL.String())
+
+	return ctx, span
+}
+
+// traceResponseBody ends the span once the response body is closed, with the
+// number of bytes read.
+func traceResponseBody(res *http.Response, span tracing.Span) io.ReadCloser {
+	span.SetStatusCode(res.StatusCode)
+
+	// the body of a protocol upgrade must stay writable
+	if _, ok := res.Body.(io.Writer); ok {
+		return onClose(res.Body, span.End)
+	}
+
+	counter := &countingReader{ReadCloser: res.Body}
+
+	return onClose(counter, func() {
+		span.SetAttribute("http.response_body_bytes", counter.n)
+		span.End()
+	})
+}
+
+func endProxySpan(span tracing.Span, result proxy.Result, err error) {
+	if result.StatusCode != 0 {
+		span.SetStatusCode(result.StatusCode)
+	}
+	span.SetAttribute("proxy.bytes_read", result.BytesRead)
+	span.SetAttribute("proxy.bytes_written", result.BytesWritten)
+	span.SetAttribute("proxy.json_intercepted", result.JSONIntercepted)
+	span.SetAttribute("proxy.short_circuited", result.ShortCircuited)
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	span.End()
+}
+
+func setDurationAttribute(span tracing.Span, key string, start time.Time) {
+	span.SetAttribute(key, float64(time.Since(start))/float64(time.Millisecond))
+}
@@ -0,0 +1,62 @@
+package api_client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+func TestProxyTrace(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	c := NewClient(WithBaseURL(upstream.URL), WithHTTPClient(upstream.Client()))
+
+	var (
+		mu      sync.Mutex
+		timings []proxy.Timings
+	)
+	observer := proxy.WithObserver(func(e proxy.Event) {
+		if e.Type == proxy.EventTypeTimings {
+			mu.Lock()
+			timings = append(timings, e.Timings)
+			mu.Unlock()
+		}
+	})
+
+	proxyGet(t, c, "/untraced", nil, observer)
+	if len(timings) != 0 {
+		t.Fatalf("got %d timings without WithTrace", len(timings))
+	}
+
+	// so that the first traced request dials
+	upstream.CloseClientConnections()
+
+	for i := 0; i < 2; i++ {
+		proxyGet(t, c, "/traced", nil, observer, proxy.WithTrace())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(timings) != 2 {
+		t.Fatalf("got %d timings, want 2", len(timings))
+	}
+	for i, tm := range timings {
+		if tm.TimeToFirstByte < 20*time.Millisecond {
+			t.Errorf("request %d: TimeToFirstByte = %v, want at least the handler delay", i, tm.TimeToFirstByte)
+		}
+	}
+	if first := timings[0]; first.ConnReused || first.Connect <= 0 || first.TLSHandshake <= 0 {
+		t.Errorf("first request: %+v, want a new connection", first)
+	}
+	if second := timings[1]; !second.ConnReused || second.Connect != 0 || second.TLSHandshake != 0 {
+		t.Errorf("second request: %+v, want the reused connection", second)
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/operaads/api-client/tracing/otel
+
+go 1.18
+
+require (
+	github.com/operaads/api-client v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v0.14.0
+)
+
+replace github.com/operaads/api-client => ../..
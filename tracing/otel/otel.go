@@ -0,0 +1,79 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+
+	api "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/operaads/api-client/tracing"
+)
+
+const instrumentationName = "github.com/operaads/api-client"
+
+// Tracer is a tracing.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+var _ tracing.Tracer = (*Tracer)(nil)
+
+// NewTracer creates the tracer. The global tracer provider is used when nil,
+// and the W3C trace context propagator, sending the traceparent and
+// tracestate headers, when the propagator is nil.
+func NewTracer(provider trace.TracerProvider, propagator propagation.TextMapPropagator) *Tracer {
+	if provider == nil {
+		provider = api.GetTracerProvider()
+	}
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	return &Tracer{
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagator,
+	}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, kind tracing.SpanKind) (context.Context, tracing.Span) {
+	spanKind := trace.SpanKindInternal
+	if kind == tracing.SpanKindClient {
+		spanKind = trace.SpanKindClient
+	}
+
+	ctx, s := t.tracer.Start(ctx, name, trace.WithSpanKind(spanKind))
+
+	return ctx, span{s}
+}
+
+func (t *Tracer) Inject(ctx context.Context, header http.Header) {
+	t.propagator.Inject(ctx, header)
+}
+
+type span struct {
+	trace.Span
+}
+
+func (s span) SetAttribute(key string, value interface{}) {
+	s.SetAttributes(label.Any(key, value))
+}
+
+func (s span) SetStatusCode(code int) {
+	s.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(code)...)
+	s.SetStatus(semconv.SpanStatusFromHTTPStatusCode(code))
+}
+
+func (s span) RecordError(err error) {
+	s.Span.RecordError(err)
+	s.SetStatus(codes.Error, err.Error())
+}
+
+func (s span) End() {
+	s.Span.End()
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+)
+
+type SpanKind int
+
+const (
+	// SpanKindInternal is the kind of the proxy spans.
+	SpanKindInternal SpanKind = iota
+	// SpanKindClient is the kind of the upstream request spans.
+	SpanKindClient
+)
+
+// Tracer creates the spans of the client requests, e.g. the OpenTelemetry
+// one of the tracing/otel module.
+type Tracer interface {
+	// Start starts a span, child of the span of ctx if any, and returns a
+	// context holding it.
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+
+	// Inject propagates the span of ctx to the upstream, in the request
+	// headers.
+	Inject(ctx context.Context, header http.Header)
+}
+
+type Span interface {
+	SetAttribute(key string, value interface{})
+	SetStatusCode(code int)
+	RecordError(err error)
+	End()
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context holding the span, so that it can be
+// annotated with SpanFromContext.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span of the context set by ContextWithSpan, or
+// nil.
+func SpanFromContext(ctx context.Context) Span {
+	span, _ := ctx.Value(spanKey{}).(Span)
+	return span
+}
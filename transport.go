@@ -0,0 +1,84 @@
+package api_client
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// the dialer settings of http.DefaultTransport
+const (
+	defaultDialTimeout = 30 * time.Second
+	defaultKeepAlive   = 30 * time.Second
+)
+
+func (o *Options) transport() http.RoundTripper {
+	if o.Transport != nil {
+		return o.Transport
+	}
+
+	if o.MaxIdleConns == 0 && o.MaxIdleConnsPerHost == 0 && o.MaxConnsPerHost == 0 && o.IdleConnTimeout == 0 &&
+		o.KeepAlive == 0 && !o.DisableKeepAlives && o.TLSConfig == nil && len(o.TransportConfigs) == 0 &&
+		o.DialTimeout == 0 && o.TLSHandshakeTimeout == 0 && o.ResponseHeaderTimeout == 0 {
+		return nil
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if o.MaxIdleConns > 0 {
+		t.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+		if t.MaxIdleConns > 0 && t.MaxIdleConns < o.MaxIdleConnsPerHost {
+			t.MaxIdleConns = o.MaxIdleConnsPerHost
+		}
+	}
+	if o.MaxConnsPerHost > 0 {
+		t.MaxConnsPerHost = o.MaxConnsPerHost
+	}
+	if o.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.TLSConfig != nil {
+		t.TLSClientConfig = o.TLSConfig
+	}
+	if o.KeepAlive != 0 || o.DialTimeout > 0 {
+		dialer := &net.Dialer{
+			Timeout:   defaultDialTimeout,
+			KeepAlive: defaultKeepAlive,
+		}
+		if o.DialTimeout > 0 {
+			dialer.Timeout = o.DialTimeout
+		}
+		if o.KeepAlive != 0 {
+			dialer.KeepAlive = o.KeepAlive
+		}
+
+		t.DialContext = dialer.DialContext
+	}
+	if o.DisableKeepAlives {
+		t.DisableKeepAlives = true
+	}
+	if o.TLSHandshakeTimeout > 0 {
+		t.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+	}
+	if o.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = o.ResponseHeaderTimeout
+	}
+
+	for _, configure := range o.TransportConfigs {
+		configure(t)
+	}
+
+	return t
+}
+
+func (o *Options) tlsConfig() *tls.Config {
+	if o.TLSConfig == nil {
+		o.TLSConfig = new(tls.Config)
+	}
+
+	return o.TLSConfig
+}
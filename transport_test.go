@@ -0,0 +1,72 @@
+package api_client
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/operaads/api-client/request"
+)
+
+func TestConnectionPoolOptions(t *testing.T) {
+	c := NewClient(WithMaxIdleConnsPerHost(64), WithMaxConnsPerHost(128), WithIdleConnTimeout(time.Minute))
+
+	transport, ok := c.Client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport = %T, want *http.Transport", c.Client.Transport)
+	}
+	if transport.MaxIdleConnsPerHost != 64 || transport.MaxConnsPerHost != 128 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("transport = %d idle/host, %d conns/host, %v idle timeout, want 64, 128, 1m",
+			transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	custom := &http.Client{}
+	if c := NewClient(WithHTTPClient(custom), WithMaxIdleConnsPerHost(64)); c.Client != custom || custom.Transport != nil {
+		t.Error("the connection pool options changed the injected http client")
+	}
+}
+
+// BenchmarkConnectionReuse sends parallel requests, reporting the connections
+// opened per request: close to 0 when they're kept alive and reused.
+func BenchmarkConnectionReuse(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"max idle per host", []Option{WithMaxIdleConnsPerHost(64)}},
+		{"disable keep-alives", []Option{WithDisableKeepAlives()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var conns int64
+			upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					atomic.AddInt64(&conns, 1)
+				}
+			}
+			upstream.Start()
+			defer upstream.Close()
+
+			c := NewClient(append([]Option{WithBaseURL(upstream.URL)}, bc.opts...)...)
+
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					res, err := c.DoAPIRequest(request.NewAPIRequest(http.MethodGet, "/", nil))
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					res.Body.Close()
+				}
+			})
+
+			b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package api_client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/operaads/api-client/proxy"
+)
+
+// ProxyWebSocket proxies a WebSocket handshake upstream, then bridges the
+// frames between the client and the upstream until either side closes the
+// connection or the incoming request is done. Close frames are forwarded as
+// is, and when a side goes away without one, the other side is sent a close
+// frame. Other protocol upgrades are piped as bytes.
+func (c *Client) ProxyWebSocket(httpReq *http.Request, resWriter http.ResponseWriter, opts ...proxy.Option) error {
+	if !isUpgradeRequest(httpReq) {
+		return proxy.ErrNotUpgradeRequest
+	}
+
+	hijacker, ok := resWriter.(http.Hijacker)
+	if !ok {
+		return proxy.ErrHijackNotSupported
+	}
+
+	opt := c.newProxyOptions(opts...)
+
+	isWebSocket := headerHasToken(httpReq.Header, "Upgrade", "websocket")
+
+	var offered []string
+	if isWebSocket {
+		offered = headerTokens(httpReq.Header, "Sec-WebSocket-Protocol")
+		if opt.WebSocketSubprotocols != nil {
+			offered = allowedSubprotocols(offered, opt.WebSocketSubprotocols)
+
+			httpReq = httpReq.Clone(httpReq.Context())
+			httpReq.Header.Del("Sec-WebSocket-Protocol")
+			if len(offered) > 0 {
+				httpReq.Header.Set("Sec-WebSocket-Protocol", strings.Join(offered, ", "))
+			}
+		}
+	}
+
+	res, err := c.proxyAPIResponse("", "", httpReq, proxy.RequestBodyTypeNone, opt)
+	if err != nil {
+		return err
+	}
+
+	// the upstream refused to switch protocols
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return writeProxyResponse(httpReq, res, resWriter, opt, &proxy.Result{})
+	}
+
+	backConn, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		res.Body.Close()
+		return proxy.ErrUpgradeNotSupported
+	}
+	defer backConn.Close()
+
+	if selected := res.Header.Get("Sec-WebSocket-Protocol"); isWebSocket && selected != "" && !containsToken(offered, selected) {
+		http.Error(resWriter, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return proxy.ErrWebSocketSubprotocol
+	}
+
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := writeSwitchingProtocols(brw.Writer, res.Header); err != nil {
+		return err
+	}
+
+	if isWebSocket {
+		return bridgeWebSocket(httpReq.Context(), newFrameWriter(conn, false), brw.Reader, newFrameWriter(backConn, true), backConn)
+	}
+
+	errc := make(chan error, 2)
+	go pipe(backConn, brw.Reader, errc)
+	go pipe(conn, backConn, errc)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-httpReq.Context().Done():
+		return httpReq.Context().Err()
+	}
+}
+
+// bridgeWebSocket copies the frames both ways, until the close handshake is
+// done or a side goes away.
+func bridgeWebSocket(ctx context.Context, client *frameWriter, clientSrc io.Reader, back *frameWriter, backSrc io.Reader) error {
+	type copyResult struct {
+		closed   bool
+		err      error
+		toClient bool
+	}
+
+	results := make(chan copyResult, 2)
+	go func() {
+		closed, err := copyFrames(client, backSrc)
+		results <- copyResult{closed: closed, err: err, toClient: true}
+	}()
+	go func() {
+		closed, err := copyFrames(back, clientSrc)
+		results <- copyResult{closed: closed, err: err}
+	}()
+
+	var closing bool
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-results:
+			if r.closed {
+				// wait for the other side to reply
+				closing = true
+				continue
+			}
+
+			if !closing {
+				if r.toClient {
+					client.writeClose(wsCloseBadGateway)
+				} else {
+					back.writeClose(wsCloseGoingAway)
+				}
+			}
+			if r.err == io.EOF {
+				return nil
+			}
+
+			return r.err
+		case <-ctx.Done():
+			if !closing {
+				client.writeClose(wsCloseGoingAway)
+				back.writeClose(wsCloseGoingAway)
+			}
+
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func isUpgradeRequest(req *http.Request) bool {
+	return headerHasToken(req.Header, "Connection", "upgrade") && req.Header.Get("Upgrade") != ""
+}
+
+// allowedSubprotocols returns the offered subprotocols that are allowed, in
+// the client's order of preference.
+func allowedSubprotocols(offered, allowed []string) []string {
+	var protocols []string
+	for _, p := range offered {
+		if containsToken(allowed, p) {
+			protocols = append(protocols, p)
+		}
+	}
+
+	return protocols
+}
+
+func headerTokens(h http.Header, key string) []string {
+	var tokens []string
+	for _, v := range h[http.CanonicalHeaderKey(key)] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+
+	return tokens
+}
+
+func containsToken(tokens []string, token string) bool {
+	for _, t := range tokens {
+		if t == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeSwitchingProtocols(w *bufio.Writer, header http.Header) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", http.StatusSwitchingProtocols, http.StatusText(http.StatusSwitchingProtocols)); err != nil {
+		return err
+	}
+	if err := header.Write(w); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func pipe(dst io.Writer, src io.Reader, errc chan<- error) {
+	_, err := io.Copy(dst, src)
+	errc <- err
+}
@@ -0,0 +1,134 @@
+package api_client
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+const (
+	wsOpClose = 0x8
+
+	wsCloseGoingAway  = 1001
+	wsCloseBadGateway = 1014
+
+	// how long a close frame waits for a frame being copied to be done
+	wsCloseWait = time.Second
+)
+
+// frameWriter writes whole frames to a side of the bridge, so that a close
+// frame can be sent between two copied frames.
+type frameWriter struct {
+	w io.Writer
+
+	// frames sent upstream must be masked
+	mask bool
+
+	// held while a frame is written
+	lock chan struct{}
+}
+
+func newFrameWriter(w io.Writer, mask bool) *frameWriter {
+	return &frameWriter{w: w, mask: mask, lock: make(chan struct{}, 1)}
+}
+
+// copyFrames copies the frames read from src, until it fails or a close frame
+// is copied.
+func copyFrames(dst *frameWriter, src io.Reader) (closed bool, err error) {
+	for {
+		header, opcode, length, err := readFrameHeader(src)
+		if err != nil {
+			return false, err
+		}
+
+		dst.lock <- struct{}{}
+		_, err = dst.w.Write(header)
+		if err == nil {
+			_, err = io.CopyN(dst.w, src, length)
+		}
+		<-dst.lock
+
+		if err != nil {
+			return false, err
+		}
+		if opcode == wsOpClose {
+			return true, nil
+		}
+	}
+}
+
+// readFrameHeader reads the header of a frame, up to its payload (RFC 6455,
+// section 5.2).
+func readFrameHeader(r io.Reader) (header []byte, opcode byte, length int64, err error) {
+	header = make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, 0, err
+	}
+
+	opcode = header[0] & 0x0f
+	length = int64(header[1] & 0x7f)
+
+	var extra int
+	switch length {
+	case 126:
+		extra = 2
+	case 127:
+		extra = 8
+	}
+	lengthBytes := extra
+	if header[1]&0x80 != 0 {
+		extra += 4
+	}
+
+	if extra > 0 {
+		header = header[:2+extra]
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return nil, 0, 0, err
+		}
+
+		switch lengthBytes {
+		case 2:
+			length = int64(binary.BigEndian.Uint16(header[2:4]))
+		case 8:
+			length = int64(binary.BigEndian.Uint64(header[2:10]) &^ (1 << 63))
+		}
+	}
+
+	return header, opcode, length, nil
+}
+
+// writeClose sends a close frame with the status code, unless a frame being
+// copied doesn't end in time.
+func (w *frameWriter) writeClose(code uint16) {
+	timer := time.NewTimer(wsCloseWait)
+	defer timer.Stop()
+
+	select {
+	case w.lock <- struct{}{}:
+	case <-timer.C:
+		return
+	}
+	defer func() {
+		<-w.lock
+	}()
+
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, code)
+
+	frame := []byte{0x80 | wsOpClose, byte(len(payload))}
+	if w.mask {
+		key := make([]byte, 4)
+		if _, err := rand.Read(key); err != nil {
+			return
+		}
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+
+		frame[1] |= 0x80
+		frame = append(frame, key...)
+	}
+
+	w.w.Write(append(frame, payload...))
+}